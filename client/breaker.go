@@ -0,0 +1,272 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"github.com/xialeistudio/go-service-discovery/discovery"
+	"sync"
+	"time"
+)
+
+// CircuitOpenError 熔断器打开，请求被快速拒绝
+type CircuitOpenError struct {
+	ServiceName string
+	// Node 熔断的节点，服务级熔断或全部节点熔断时为 nil
+	Node *discovery.ServiceNode
+}
+
+func (e *CircuitOpenError) Error() string {
+	if e.Node != nil {
+		return "circuit breaker is open: " + e.ServiceName + " " + e.Node.Address()
+	}
+	return "circuit breaker is open: " + e.ServiceName
+}
+
+// BreakerConfig 熔断配置
+type BreakerConfig struct {
+	// FailureThreshold 节点连续失败多少次后熔断，默认 5
+	FailureThreshold int
+	// ServiceFailureRate 统计周期内服务整体的失败率达到该值时熔断整个服务，默认 0.5
+	ServiceFailureRate float64
+	// ServiceMinRequests 统计周期内服务的请求数不少于该值时才计算失败率，默认 20
+	ServiceMinRequests int
+	// Interval 服务失败率的统计周期，默认 10 秒
+	Interval time.Duration
+	// OpenDuration 熔断时长，结束后进入半开状态，默认 30 秒
+	OpenDuration time.Duration
+	// HalfOpenRequests 半开状态允许通过的探测请求数，全部成功后恢复，任一失败则重新熔断，默认 1
+	HalfOpenRequests int
+}
+
+type breakerState int
+
+const (
+	breakerClosed breakerState = iota
+	breakerOpen
+	breakerHalfOpen
+)
+
+// breaker 熔断器，generation 在每次状态变化时递增，用于忽略状态变化之前发出的请求的结果
+type breaker struct {
+	state               breakerState
+	generation          uint64
+	openUntil           time.Time
+	consecutiveFailures int
+	requests            int
+	failures            int
+	windowStart         time.Time
+	probes              int // 半开状态已放行的探测请求数
+	successes           int // 半开状态成功的探测请求数
+}
+
+// reserve 放行一个请求，半开状态下同时占用一个探测名额，返回请求所属的 generation，不放行时返回 false
+func (b *breaker) reserve(now time.Time, config BreakerConfig) (uint64, bool) {
+	if b.state == breakerOpen {
+		if now.Before(b.openUntil) {
+			return 0, false
+		}
+		b.transition(breakerHalfOpen, now)
+	}
+	if b.state == breakerHalfOpen {
+		if b.probes >= config.HalfOpenRequests {
+			return 0, false
+		}
+		b.probes++
+	}
+	return b.generation, true
+}
+
+// release 归还未使用的探测名额
+func (b *breaker) release(generation uint64) {
+	if generation == b.generation && b.state == breakerHalfOpen {
+		b.probes--
+	}
+}
+
+// record 记录请求结果，tripped 判断关闭状态下是否需要熔断
+func (b *breaker) record(generation uint64, err error, now time.Time, config BreakerConfig, tripped func(b *breaker) bool) {
+	if generation != b.generation {
+		return
+	}
+	if errors.Is(err, context.Canceled) {
+		// 被取消的请求不计入统计，归还半开状态的探测名额
+		b.release(generation)
+		return
+	}
+	switch b.state {
+	case breakerHalfOpen:
+		if err != nil {
+			b.transition(breakerOpen, now)
+			b.openUntil = now.Add(config.OpenDuration)
+			return
+		}
+		b.successes++
+		if b.successes >= config.HalfOpenRequests {
+			b.transition(breakerClosed, now)
+		}
+	case breakerClosed:
+		if now.Sub(b.windowStart) >= config.Interval {
+			b.windowStart, b.requests, b.failures = now, 0, 0
+		}
+		b.requests++
+		if err == nil {
+			b.consecutiveFailures = 0
+			return
+		}
+		b.failures++
+		b.consecutiveFailures++
+		if tripped(b) {
+			b.transition(breakerOpen, now)
+			b.openUntil = now.Add(config.OpenDuration)
+		}
+	}
+}
+
+func (b *breaker) transition(state breakerState, now time.Time) {
+	b.state = state
+	b.generation++
+	b.consecutiveFailures, b.requests, b.failures, b.windowStart = 0, 0, 0, now
+	b.probes, b.successes = 0, 0
+}
+
+type breakerService struct {
+	mu      sync.Mutex
+	service breaker
+	nodes   map[string]*breaker // <ip:port>，只保存出现过失败的节点
+}
+
+// circuitBreaker 节点和服务两级熔断
+type circuitBreaker struct {
+	config   BreakerConfig
+	now      func() time.Time
+	services sync.Map // <serviceName, *breakerService>
+}
+
+func newCircuitBreaker(config BreakerConfig) *circuitBreaker {
+	if config.FailureThreshold <= 0 {
+		config.FailureThreshold = 5
+	}
+	if config.ServiceFailureRate <= 0 || config.ServiceFailureRate > 1 {
+		config.ServiceFailureRate = 0.5
+	}
+	if config.ServiceMinRequests <= 0 {
+		config.ServiceMinRequests = 20
+	}
+	if config.Interval <= 0 {
+		config.Interval = 10 * time.Second
+	}
+	if config.OpenDuration <= 0 {
+		config.OpenDuration = 30 * time.Second
+	}
+	if config.HalfOpenRequests <= 0 {
+		config.HalfOpenRequests = 1
+	}
+	return &circuitBreaker{config: config, now: time.Now}
+}
+
+func (c *circuitBreaker) service(serviceName string) *breakerService {
+	value, exists := c.services.Load(serviceName)
+	if !exists {
+		value, _ = c.services.LoadOrStore(serviceName, &breakerService{nodes: make(map[string]*breaker)})
+	}
+	return value.(*breakerService)
+}
+
+// breakerPermit filter 放行请求时占用的熔断器名额，选中节点后通过 acquire 保留选中节点的名额，归还其余节点的名额
+type breakerPermit struct {
+	c                 *circuitBreaker
+	service           *breakerService
+	serviceGeneration uint64
+	nodes             map[string]uint64 // <ip:port, generation>，只包含已有熔断器的节点
+}
+
+// filter 过滤掉熔断的节点并占用放行名额，服务熔断或全部节点熔断时返回 CircuitOpenError
+// 同一临界区内检查并占用半开状态的探测名额，并发请求不会超过 HalfOpenRequests
+func (c *circuitBreaker) filter(serviceName string, nodes []*discovery.ServiceNode) ([]*discovery.ServiceNode, *breakerPermit, error) {
+	service := c.service(serviceName)
+	now := c.now()
+
+	service.mu.Lock()
+	defer service.mu.Unlock()
+	serviceGeneration, ok := service.service.reserve(now, c.config)
+	if !ok {
+		return nil, nil, &CircuitOpenError{ServiceName: serviceName}
+	}
+	permit := &breakerPermit{c: c, service: service, serviceGeneration: serviceGeneration, nodes: make(map[string]uint64)}
+	result := make([]*discovery.ServiceNode, 0, len(nodes))
+	for _, node := range nodes {
+		key := node.Address()
+		b := service.nodes[key]
+		if b == nil {
+			result = append(result, node)
+			continue
+		}
+		if generation, ok := b.reserve(now, c.config); ok {
+			permit.nodes[key] = generation
+			result = append(result, node)
+		}
+	}
+	if len(result) == 0 && len(nodes) > 0 {
+		service.service.release(serviceGeneration)
+		if len(nodes) == 1 {
+			return nil, nil, &CircuitOpenError{ServiceName: serviceName, Node: nodes[0]}
+		}
+		return nil, nil, &CircuitOpenError{ServiceName: serviceName}
+	}
+	return result, permit, nil
+}
+
+// release 没有选中节点时归还全部名额
+func (p *breakerPermit) release() {
+	p.service.mu.Lock()
+	defer p.service.mu.Unlock()
+	p.service.service.release(p.serviceGeneration)
+	p.releaseNodes("")
+}
+
+// releaseNodes 归还 except 以外节点的名额
+func (p *breakerPermit) releaseNodes(except string) {
+	for key, generation := range p.nodes {
+		if b := p.service.nodes[key]; b != nil && key != except {
+			b.release(generation)
+		}
+	}
+}
+
+// acquire 保留选中节点的名额，返回的函数用于记录请求结果
+func (p *breakerPermit) acquire(node *discovery.ServiceNode) func(err error) {
+	c, service, serviceGeneration := p.c, p.service, p.serviceGeneration
+	key := node.Address()
+
+	service.mu.Lock()
+	p.releaseNodes(key)
+	// 节点没有熔断器时 generation 为 0，与首次失败时创建的熔断器一致
+	nodeGeneration := p.nodes[key]
+	service.mu.Unlock()
+
+	return func(err error) {
+		service.mu.Lock()
+		defer service.mu.Unlock()
+		now := c.now()
+		service.service.record(serviceGeneration, err, now, c.config, func(b *breaker) bool {
+			return b.requests >= c.config.ServiceMinRequests && float64(b.failures) >= c.config.ServiceFailureRate*float64(b.requests)
+		})
+
+		b := service.nodes[key]
+		if b == nil {
+			if err == nil || errors.Is(err, context.Canceled) {
+				return
+			}
+			// 节点首次失败时创建熔断器，请求发出时熔断器还不存在，generation 为 0
+			b = &breaker{windowStart: now}
+			service.nodes[key] = b
+		}
+		b.record(nodeGeneration, err, now, c.config, func(b *breaker) bool {
+			return b.consecutiveFailures >= c.config.FailureThreshold
+		})
+		if b.state == breakerClosed && b.consecutiveFailures == 0 {
+			// 恢复正常的节点不再保存状态
+			delete(service.nodes, key)
+		}
+	}
+}
@@ -0,0 +1,189 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/xialeistudio/go-service-discovery/discovery"
+	"github.com/xialeistudio/go-service-discovery/loadbalancer"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// filterBreaker 返回熔断器放行的节点，不占用名额
+func filterBreaker(b *circuitBreaker, nodes []*discovery.ServiceNode) ([]*discovery.ServiceNode, error) {
+	candidates, permit, err := b.filter("test", nodes)
+	if permit != nil {
+		permit.release()
+	}
+	return candidates, err
+}
+
+// acquireBreaker 放行 node 的请求，返回记录结果的函数
+func acquireBreaker(b *circuitBreaker, node *discovery.ServiceNode) func(err error) {
+	_, permit, err := b.filter("test", []*discovery.ServiceNode{node})
+	if err != nil {
+		return func(error) {}
+	}
+	return permit.acquire(node)
+}
+
+func Test_circuitBreaker_node(t *testing.T) {
+	a := assert.New(t)
+	now := time.Now()
+	b := newCircuitBreaker(BreakerConfig{FailureThreshold: 2, OpenDuration: time.Second, HalfOpenRequests: 2})
+	b.now = func() time.Time { return now }
+	nodes := newTestNodes()
+
+	// 连续失败后熔断
+	acquireBreaker(b, nodes[0])(errTest)
+	acquireBreaker(b, nodes[0])(errTest)
+	candidates, err := filterBreaker(b, nodes)
+	a.Nil(err)
+	a.Equal(nodes[1:], candidates)
+	_, err = filterBreaker(b, nodes[:1])
+	var openErr *CircuitOpenError
+	a.True(errors.As(err, &openErr))
+	a.Equal(nodes[0], openErr.Node)
+
+	// 熔断结束后进入半开状态，只放行 HalfOpenRequests 个请求
+	now = now.Add(time.Second)
+	candidates, err = filterBreaker(b, nodes)
+	a.Nil(err)
+	a.Len(candidates, 3)
+	record1 := acquireBreaker(b, nodes[0])
+	record2 := acquireBreaker(b, nodes[0])
+	candidates, _ = filterBreaker(b, nodes)
+	a.Equal(nodes[1:], candidates)
+
+	// 探测请求失败后重新熔断
+	record1(nil)
+	record2(errTest)
+	candidates, _ = filterBreaker(b, nodes)
+	a.Equal(nodes[1:], candidates)
+
+	// 探测请求全部成功后恢复
+	now = now.Add(time.Second)
+	record1 = acquireBreaker(b, nodes[0])
+	record2 = acquireBreaker(b, nodes[0])
+	record1(nil)
+	candidates, _ = filterBreaker(b, nodes)
+	a.Equal(nodes[1:], candidates)
+	record2(nil)
+	candidates, _ = filterBreaker(b, nodes)
+	a.Len(candidates, 3)
+}
+
+func Test_circuitBreaker_service(t *testing.T) {
+	a := assert.New(t)
+	now := time.Now()
+	b := newCircuitBreaker(BreakerConfig{FailureThreshold: 100, ServiceFailureRate: 0.5, ServiceMinRequests: 4, OpenDuration: time.Second})
+	b.now = func() time.Time { return now }
+	nodes := newTestNodes()
+
+	// 被取消的请求不计入统计
+	for i := 0; i < 4; i++ {
+		acquireBreaker(b, nodes[i%3])(context.Canceled)
+	}
+	_, err := filterBreaker(b, nodes)
+	a.Nil(err)
+
+	acquireBreaker(b, nodes[0])(nil)
+	acquireBreaker(b, nodes[1])(errTest)
+	acquireBreaker(b, nodes[2])(nil)
+	_, err = filterBreaker(b, nodes)
+	a.Nil(err)
+	acquireBreaker(b, nodes[0])(errTest)
+	_, err = filterBreaker(b, nodes)
+	var openErr *CircuitOpenError
+	a.True(errors.As(err, &openErr))
+	a.Equal("test", openErr.ServiceName)
+	a.Nil(openErr.Node)
+
+	// 熔断期间发出的请求结果被忽略
+	now = now.Add(time.Second)
+	_, err = filterBreaker(b, nodes)
+	a.Nil(err)
+	acquireBreaker(b, nodes[0])(nil)
+	_, err = filterBreaker(b, nodes)
+	a.Nil(err)
+}
+
+func TestClient_Resolve_circuitBreaker(t *testing.T) {
+	a := assert.New(t)
+	nodes := newTestNodes()
+	c := New(loadbalancer.NewRoundRobin(), &memoryRegistry{nodes: nodes}, WithCircuitBreaker(BreakerConfig{FailureThreshold: 1}))
+	ctx := context.Background()
+
+	// 节点熔断后选择其他节点
+	node, done, err := c.Resolve(ctx, "test", WithTags(map[string]string{"version": "1.0"}))
+	a.Nil(err)
+	done(loadbalancer.DoneInfo{Err: errTest})
+	for i := 0; i < 3; i++ {
+		n, done, err := c.Resolve(ctx, "test", WithTags(map[string]string{"version": "1.0"}))
+		a.Nil(err)
+		a.NotEqual(node, n)
+		done(loadbalancer.DoneInfo{})
+	}
+	n, done, err := c.Resolve(ctx, "test", WithTags(map[string]string{"version": "1.0"}))
+	a.Nil(err)
+	done(loadbalancer.DoneInfo{Err: errTest})
+	a.NotEqual(node, n)
+
+	// 全部节点熔断时快速失败
+	_, _, err = c.Resolve(ctx, "test", WithTags(map[string]string{"version": "1.0"}))
+	var openErr *CircuitOpenError
+	a.True(errors.As(err, &openErr))
+}
+
+// slowBalancer 选择节点前等待一段时间，放大并发请求之间的竞争
+type slowBalancer struct {
+	delay time.Duration
+}
+
+func (s *slowBalancer) Select(_ context.Context, _ string, nodes []*discovery.ServiceNode) (*discovery.ServiceNode, loadbalancer.DoneFunc) {
+	time.Sleep(s.delay)
+	if len(nodes) == 0 {
+		return nil, func(loadbalancer.DoneInfo) {}
+	}
+	return nodes[0], func(loadbalancer.DoneInfo) {}
+}
+
+func TestClient_Resolve_circuitBreaker_halfOpen(t *testing.T) {
+	a := assert.New(t)
+	nodes := newTestNodes()[:1]
+	c := New(&slowBalancer{delay: time.Millisecond}, &memoryRegistry{nodes: nodes}, WithCircuitBreaker(BreakerConfig{FailureThreshold: 1, OpenDuration: time.Second}))
+	now := time.Now()
+	c.breaker.now = func() time.Time { return now }
+	ctx := context.Background()
+
+	_, done, err := c.Resolve(ctx, "test")
+	a.Nil(err)
+	done(loadbalancer.DoneInfo{Err: errTest})
+	now = now.Add(time.Second)
+
+	// 并发请求中只有一个探测请求通过
+	var wg sync.WaitGroup
+	var passed atomic.Int32
+	dones := make(chan loadbalancer.DoneFunc, 50)
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, done, err := c.Resolve(ctx, "test"); err == nil {
+				passed.Add(1)
+				dones <- done
+			}
+		}()
+	}
+	wg.Wait()
+	a.EqualValues(1, passed.Load())
+
+	// 探测请求被取消后归还名额
+	(<-dones)(loadbalancer.DoneInfo{Err: context.Canceled})
+	_, done, err = c.Resolve(ctx, "test")
+	a.Nil(err)
+	done(loadbalancer.DoneInfo{})
+}
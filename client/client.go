@@ -2,28 +2,212 @@ package client
 
 import (
 	"context"
+	"errors"
+	"fmt"
 	"github.com/xialeistudio/go-service-discovery/discovery"
 	"github.com/xialeistudio/go-service-discovery/loadbalancer"
+	"sync"
+)
+
+var (
+	// ErrNoAvailableNode 没有可供选择的服务节点
+	ErrNoAvailableNode = errors.New("no available service node")
+	// ErrInsufficientNodes 可用节点数少于 WithMinHealthy 要求的数量
+	ErrInsufficientNodes = errors.New("insufficient healthy service nodes")
 )
 
 // Client 服务发现客户端
 type Client struct {
 	LoadBalancer loadbalancer.LoadBalancer
 	Registry     discovery.NodeRegistry
+
+	outlier *outlierDetector
+	health  *healthChecker
+	breaker *circuitBreaker
+
+	retryBudget RetryBudgetConfig
+	budgets     sync.Map // <serviceName, *retryBudget>
+}
+
+// Option 客户端选项
+type Option func(c *Client)
+
+// WithOutlierDetection 启用异常节点检测，连续失败或失败率过高的节点在一段时间内不参与选择
+func WithOutlierDetection(config OutlierConfig) Option {
+	return func(c *Client) {
+		c.outlier = newOutlierDetector(config)
+	}
+}
+
+// WithHealthCheck 启用主动健康检查，定时探测解析过的服务的所有节点，探测失败的节点不参与选择
+func WithHealthCheck(config HealthCheckConfig) Option {
+	return func(c *Client) {
+		c.health = newHealthChecker(c.Registry, config)
+	}
+}
+
+// WithCircuitBreaker 启用节点和服务两级熔断，熔断的节点不参与选择，服务熔断或全部节点熔断时返回 *CircuitOpenError
+func WithCircuitBreaker(config BreakerConfig) Option {
+	return func(c *Client) {
+		c.breaker = newCircuitBreaker(config)
+	}
 }
 
 // New 创建服务发现客户端
-func New(loadBalancer loadbalancer.LoadBalancer, registry discovery.NodeRegistry) *Client {
-	return &Client{LoadBalancer: loadBalancer, Registry: registry}
+func New(loadBalancer loadbalancer.LoadBalancer, registry discovery.NodeRegistry, opts ...Option) *Client {
+	c := &Client{
+		LoadBalancer: loadBalancer,
+		Registry:     registry,
+		retryBudget:  RetryBudgetConfig{Ratio: 0.2, MaxTokens: 10},
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+	return c
+}
+
+// Close 停止客户端的后台协程，不会关闭注册中心
+func (c *Client) Close() error {
+	if c.health != nil {
+		c.health.Close()
+	}
+	return nil
+}
+
+// ResolveOption 服务解析选项
+type ResolveOption func(o *resolveOptions)
+
+type resolveOptions struct {
+	tags       map[string]string
+	filters    []func(node *discovery.ServiceNode) bool
+	exclude    map[string]struct{} // <ip:port>
+	minHealthy int
+	hashKey    *string
+}
+
+// WithTags 只选择标签匹配的节点
+func WithTags(tags map[string]string) ResolveOption {
+	return func(o *resolveOptions) {
+		o.tags = tags
+	}
+}
+
+// WithFilter 自定义过滤函数，返回 false 的节点不参与选择，多个过滤函数需同时满足
+func WithFilter(filter func(node *discovery.ServiceNode) bool) ResolveOption {
+	return func(o *resolveOptions) {
+		o.filters = append(o.filters, filter)
+	}
+}
+
+// WithExclude 排除指定节点，一般用于重试时跳过已尝试过的节点
+func WithExclude(nodes ...*discovery.ServiceNode) ResolveOption {
+	return func(o *resolveOptions) {
+		if o.exclude == nil {
+			o.exclude = make(map[string]struct{}, len(nodes))
+		}
+		for _, node := range nodes {
+			o.exclude[node.Address()] = struct{}{}
+		}
+	}
+}
+
+// WithMinHealthy 标签、过滤函数、健康检查和异常节点检测筛选后的节点数少于 n 时返回 ErrInsufficientNodes
+func WithMinHealthy(n int) ResolveOption {
+	return func(o *resolveOptions) {
+		o.minHealthy = n
+	}
 }
 
-// Resolve 获取服务节点
-func (c *Client) Resolve(ctx context.Context, serviceName string) (*discovery.ServiceNode, error) {
-	nodes, err := c.Registry.GetNodes(ctx, serviceName, nil)
+// WithHashKey 设置请求的哈希键，供一致性哈希类负载均衡策略选择节点
+func WithHashKey(key string) ResolveOption {
+	return func(o *resolveOptions) {
+		o.hashKey = &key
+	}
+}
+
+func (o *resolveOptions) match(node *discovery.ServiceNode) bool {
+	for _, filter := range o.filters {
+		if !filter(node) {
+			return false
+		}
+	}
+	return true
+}
+
+// Resolve 获取服务节点，请求结束后必须调用返回的 done 反馈请求结果
+func (c *Client) Resolve(ctx context.Context, serviceName string, opts ...ResolveOption) (*discovery.ServiceNode, loadbalancer.DoneFunc, error) {
+	o := &resolveOptions{}
+	for _, opt := range opts {
+		opt(o)
+	}
+
+	nodes, err := c.Registry.GetNodes(ctx, serviceName, o.tags)
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
 
-	node := c.LoadBalancer.Select(serviceName, nodes)
-	return node, nil
+	// 自定义过滤
+	healthy := make([]*discovery.ServiceNode, 0, len(nodes))
+	for _, node := range nodes {
+		if o.match(node) {
+			healthy = append(healthy, node)
+		}
+	}
+	if c.health != nil {
+		healthy = c.health.filter(serviceName, healthy)
+	}
+	if c.outlier != nil {
+		healthy = c.outlier.filter(serviceName, healthy)
+	}
+	if len(healthy) < o.minHealthy {
+		return nil, nil, fmt.Errorf("%w: service %s has %d nodes, want at least %d", ErrInsufficientNodes, serviceName, len(healthy), o.minHealthy)
+	}
+
+	// 排除已尝试过的节点
+	candidates := healthy
+	if len(o.exclude) > 0 {
+		candidates = make([]*discovery.ServiceNode, 0, len(healthy))
+		for _, node := range healthy {
+			if _, excluded := o.exclude[node.Address()]; !excluded {
+				candidates = append(candidates, node)
+			}
+		}
+	}
+
+	// 跳过熔断的节点
+	var permit *breakerPermit
+	if c.breaker != nil && len(candidates) > 0 {
+		candidates, permit, err = c.breaker.filter(serviceName, candidates)
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+
+	if o.hashKey != nil {
+		ctx = loadbalancer.WithHashKey(ctx, *o.hashKey)
+	}
+	node, done := c.LoadBalancer.Select(ctx, serviceName, candidates)
+	if node == nil {
+		if permit != nil {
+			permit.release()
+		}
+		return nil, nil, fmt.Errorf("%w: %s", ErrNoAvailableNode, serviceName)
+	}
+	if c.outlier != nil || permit != nil {
+		var record func(err error)
+		if permit != nil {
+			record = permit.acquire(node)
+		}
+		lbDone := done
+		done = func(info loadbalancer.DoneInfo) {
+			if c.outlier != nil {
+				c.outlier.report(serviceName, node, info.Err)
+			}
+			if record != nil {
+				record(info.Err)
+			}
+			lbDone(info)
+		}
+	}
+	return node, done, nil
 }
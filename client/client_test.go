@@ -0,0 +1,181 @@
+package client
+
+import (
+	"context"
+	"github.com/stretchr/testify/assert"
+	"github.com/xialeistudio/go-service-discovery/discovery"
+	"github.com/xialeistudio/go-service-discovery/loadbalancer"
+	"net"
+	"sync"
+	"testing"
+	"time"
+)
+
+// memoryRegistry 基于内存的注册中心，仅用于测试
+type memoryRegistry struct {
+	mu    sync.Mutex
+	nodes []*discovery.ServiceNode
+}
+
+func (m *memoryRegistry) GetNodes(_ context.Context, serviceName string, tags map[string]string) ([]*discovery.ServiceNode, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var nodes []*discovery.ServiceNode
+	for _, node := range m.nodes {
+		if node.ServiceName == serviceName && discovery.MatchTags(node.Tags, tags) {
+			nodes = append(nodes, node)
+		}
+	}
+	return nodes, nil
+}
+
+func (m *memoryRegistry) Watch(ctx context.Context, serviceName string, tags map[string]string) (<-chan *discovery.Event, error) {
+	nodes, _ := m.GetNodes(ctx, serviceName, tags)
+	ch := make(chan *discovery.Event, 1)
+	ch <- &discovery.Event{Type: discovery.EventSync, Nodes: nodes}
+	go func() {
+		<-ctx.Done()
+		close(ch)
+	}()
+	return ch, nil
+}
+
+func (m *memoryRegistry) Register(_ context.Context, node *discovery.ServiceNode) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.nodes = append(m.nodes, node)
+	return nil
+}
+
+func (m *memoryRegistry) Unregister(_ context.Context, node *discovery.ServiceNode) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for i, n := range m.nodes {
+		if n == node {
+			m.nodes = append(m.nodes[:i], m.nodes[i+1:]...)
+			break
+		}
+	}
+	return nil
+}
+
+func (m *memoryRegistry) Close() error {
+	return nil
+}
+
+func newTestNodes() []*discovery.ServiceNode {
+	return []*discovery.ServiceNode{
+		{
+			ServiceName: "test",
+			IP:          net.IPv4(127, 0, 0, 1),
+			Port:        8484,
+			Tags: map[string]string{
+				"version": "1.0",
+				"region":  "cn",
+			},
+		},
+		{
+			ServiceName: "test",
+			IP:          net.IPv4(127, 0, 0, 2),
+			Port:        8484,
+			Tags: map[string]string{
+				"version": "1.0",
+				"region":  "us",
+			},
+		},
+		{
+			ServiceName: "test",
+			IP:          net.IPv4(127, 0, 0, 3),
+			Port:        8484,
+			Tags: map[string]string{
+				"version": "2.0",
+				"region":  "cn",
+			},
+		},
+	}
+}
+
+func TestClient_Resolve(t *testing.T) {
+	a := assert.New(t)
+	nodes := newTestNodes()
+	c := New(loadbalancer.NewRoundRobin(), &memoryRegistry{nodes: nodes})
+	ctx := context.Background()
+
+	t.Run("Resolve with tags", func(t *testing.T) {
+		node, _, err := c.Resolve(ctx, "test", WithTags(map[string]string{"version": "2.0"}))
+		a.Nil(err)
+		a.Equal(nodes[2], node)
+	})
+	t.Run("Resolve with filter", func(t *testing.T) {
+		node, _, err := c.Resolve(ctx, "test",
+			WithTags(map[string]string{"version": "1.0"}),
+			WithFilter(func(node *discovery.ServiceNode) bool {
+				return node.Tags["region"] == "us"
+			}))
+		a.Nil(err)
+		a.Equal(nodes[1], node)
+	})
+	t.Run("Resolve with exclude", func(t *testing.T) {
+		for i := 0; i < 3; i++ {
+			node, _, err := c.Resolve(ctx, "test", WithExclude(nodes[0], nodes[2]))
+			a.Nil(err)
+			a.Equal(nodes[1], node)
+		}
+		_, _, err := c.Resolve(ctx, "test", WithExclude(nodes...))
+		a.ErrorIs(err, ErrNoAvailableNode)
+	})
+	t.Run("Resolve with min healthy", func(t *testing.T) {
+		_, _, err := c.Resolve(ctx, "test", WithTags(map[string]string{"version": "2.0"}), WithMinHealthy(2))
+		a.ErrorIs(err, ErrInsufficientNodes)
+		// 排除的节点仍计入可用节点数
+		node, _, err := c.Resolve(ctx, "test", WithExclude(nodes[0]), WithMinHealthy(3))
+		a.Nil(err)
+		a.NotEqual(nodes[0], node)
+	})
+	t.Run("Resolve with hash key", func(t *testing.T) {
+		c := New(loadbalancer.NewRingHash(0), &memoryRegistry{nodes: nodes})
+		node, _, err := c.Resolve(ctx, "test", WithHashKey("user-1"))
+		a.Nil(err)
+		for i := 0; i < 3; i++ {
+			n, _, err := c.Resolve(ctx, "test", WithHashKey("user-1"))
+			a.Nil(err)
+			a.Equal(node, n)
+		}
+	})
+	t.Run("Resolve unknown service", func(t *testing.T) {
+		_, _, err := c.Resolve(ctx, "unknown")
+		a.ErrorIs(err, ErrNoAvailableNode)
+	})
+}
+
+// recordBalancer 记录反馈结果的负载均衡器
+type recordBalancer struct {
+	infos []loadbalancer.DoneInfo
+}
+
+func (r *recordBalancer) Select(_ context.Context, _ string, nodes []*discovery.ServiceNode) (*discovery.ServiceNode, loadbalancer.DoneFunc) {
+	if len(nodes) == 0 {
+		return nil, func(loadbalancer.DoneInfo) {}
+	}
+	return nodes[0], func(info loadbalancer.DoneInfo) {
+		r.infos = append(r.infos, info)
+	}
+}
+
+func TestClient_Resolve_done(t *testing.T) {
+	a := assert.New(t)
+	nodes := newTestNodes()
+	lb := &recordBalancer{}
+	c := New(lb, &memoryRegistry{nodes: nodes})
+
+	node, done, err := c.Resolve(context.Background(), "test")
+	a.Nil(err)
+	a.Equal(nodes[0], node)
+	done(loadbalancer.DoneInfo{Latency: time.Millisecond, BytesSent: 10})
+	a.Equal([]loadbalancer.DoneInfo{{Latency: time.Millisecond, BytesSent: 10}}, lb.infos)
+
+	// 解析失败时没有回调
+	_, done, err = c.Resolve(context.Background(), "unknown")
+	a.ErrorIs(err, ErrNoAvailableNode)
+	a.Nil(done)
+}
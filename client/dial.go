@@ -0,0 +1,77 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/xialeistudio/go-service-discovery/discovery"
+	"github.com/xialeistudio/go-service-discovery/loadbalancer"
+	"net"
+	"time"
+)
+
+// Dialer 按服务名建立连接，可用于数据库驱动、Redis 客户端等接受 dial 函数的场景
+type Dialer struct {
+	Client *Client
+	// Timeout 每个节点的连接超时时间，默认 3 秒
+	Timeout time.Duration
+	// MaxAttempts 最多尝试的节点数，默认 3
+	MaxAttempts int
+	// Dialer 实际建立连接的 net.Dialer，默认为零值
+	Dialer *net.Dialer
+}
+
+// DialContext 连接 address 对应的服务，address 为服务名，带有端口时端口被忽略
+// 按负载均衡器的选择顺序依次尝试不同节点，连接结果反馈给负载均衡器，ctx 中的解析选项见 ContextWithResolveOptions
+func (d *Dialer) DialContext(ctx context.Context, network, address string) (net.Conn, error) {
+	timeout := d.Timeout
+	if timeout <= 0 {
+		timeout = 3 * time.Second
+	}
+	maxAttempts := d.MaxAttempts
+	if maxAttempts <= 0 {
+		maxAttempts = 3
+	}
+	dialer := d.Dialer
+	if dialer == nil {
+		dialer = &net.Dialer{}
+	}
+	serviceName := address
+	if host, _, err := net.SplitHostPort(address); err == nil {
+		serviceName = host
+	}
+	opts := resolveOptionsFromContext(ctx)
+
+	var tried []*discovery.ServiceNode
+	var errs []error
+	for attempt := 0; attempt < maxAttempts; attempt++ {
+		node, done, err := d.Client.Resolve(ctx, serviceName, append(opts, WithExclude(tried...))...)
+		if err != nil {
+			if len(errs) == 0 {
+				return nil, err
+			}
+			// 没有更多可尝试的节点
+			break
+		}
+		tried = append(tried, node)
+
+		start := time.Now()
+		attemptCtx, cancel := context.WithTimeout(ctx, timeout)
+		conn, err := dialer.DialContext(attemptCtx, network, node.Address())
+		cancel()
+		done(loadbalancer.DoneInfo{Err: err, Latency: time.Since(start)})
+		if err == nil {
+			return conn, nil
+		}
+		errs = append(errs, err)
+		if ctx.Err() != nil {
+			break
+		}
+	}
+	return nil, fmt.Errorf("failed to dial service %s: %w", serviceName, errors.Join(errs...))
+}
+
+// DialContext 使用默认配置的 Dialer 连接服务
+func (c *Client) DialContext(ctx context.Context, network, address string) (net.Conn, error) {
+	return (&Dialer{Client: c}).DialContext(ctx, network, address)
+}
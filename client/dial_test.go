@@ -0,0 +1,69 @@
+package client
+
+import (
+	"context"
+	"github.com/stretchr/testify/assert"
+	"github.com/xialeistudio/go-service-discovery/discovery"
+	"net"
+	"testing"
+	"time"
+)
+
+// newTCPTestNode 启动接受连接的 tcp 服务并返回对应的服务节点
+func newTCPTestNode(t *testing.T) *discovery.ServiceNode {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = ln.Close() })
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			_ = conn.Close()
+		}
+	}()
+	return newListenerNode(t, ln.Addr())
+}
+
+// newClosedTestNode 返回一个无法连接的服务节点
+func newClosedTestNode(t *testing.T) *discovery.ServiceNode {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_ = ln.Close()
+	return newListenerNode(t, ln.Addr())
+}
+
+func TestDialer_DialContext(t *testing.T) {
+	a := assert.New(t)
+	up := newTCPTestNode(t)
+	down1, down2 := newClosedTestNode(t), newClosedTestNode(t)
+	lb := &recordBalancer{}
+	c := New(lb, &memoryRegistry{nodes: []*discovery.ServiceNode{down1, down2, up}})
+	ctx := context.Background()
+
+	// 依次尝试节点直到连接成功，带端口的地址忽略端口
+	conn, err := c.DialContext(ctx, "tcp", "test:6379")
+	a.Nil(err)
+	a.Equal(up.Address(), conn.RemoteAddr().String())
+	_ = conn.Close()
+	// 连接结果反馈给负载均衡器
+	a.Len(lb.infos, 3)
+	a.NotNil(lb.infos[0].Err)
+	a.NotNil(lb.infos[1].Err)
+	a.Nil(lb.infos[2].Err)
+
+	// 尝试次数用完时返回所有错误
+	d := &Dialer{Client: c, MaxAttempts: 1, Timeout: time.Second}
+	_, err = d.DialContext(ContextWithResolveOptions(ctx, WithExclude(up)), "tcp", "test")
+	a.NotNil(err)
+	a.Contains(err.Error(), "failed to dial service test")
+
+	// 服务不存在
+	_, err = c.DialContext(ctx, "tcp", "unknown")
+	a.ErrorIs(err, ErrNoAvailableNode)
+}
@@ -0,0 +1,284 @@
+package client
+
+import (
+	"context"
+	"fmt"
+	"github.com/xialeistudio/go-service-discovery/discovery"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/health/grpc_health_v1"
+	"log"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// Probe 探测节点是否健康，返回 nil 表示健康
+type Probe func(ctx context.Context, node *discovery.ServiceNode) error
+
+// TCPProbe 能建立 TCP 连接即为健康
+func TCPProbe() Probe {
+	return func(ctx context.Context, node *discovery.ServiceNode) error {
+		var dialer net.Dialer
+		conn, err := dialer.DialContext(ctx, "tcp", node.Address())
+		if err != nil {
+			return err
+		}
+		return conn.Close()
+	}
+}
+
+// HTTPProbe 对节点发起 GET 请求，响应状态码为 2xx 或 3xx 即为健康
+func HTTPProbe(path string) Probe {
+	client := &http.Client{
+		// 不跟随重定向，3xx 视为健康
+		CheckRedirect: func(*http.Request, []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+	return func(ctx context.Context, node *discovery.ServiceNode) error {
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, "http://"+node.Address()+path, nil)
+		if err != nil {
+			return err
+		}
+		resp, err := client.Do(req)
+		if err != nil {
+			return err
+		}
+		_ = resp.Body.Close()
+		if resp.StatusCode < 200 || resp.StatusCode >= 400 {
+			return fmt.Errorf("unexpected http status: %s", resp.Status)
+		}
+		return nil
+	}
+}
+
+// GRPCProbe 使用 gRPC 健康检查协议检查节点上的 service，service 为空时检查整个服务器
+// 未指定 opts 时使用不加密的连接
+func GRPCProbe(service string, opts ...grpc.DialOption) Probe {
+	if len(opts) == 0 {
+		opts = []grpc.DialOption{grpc.WithTransportCredentials(insecure.NewCredentials())}
+	}
+	return func(ctx context.Context, node *discovery.ServiceNode) error {
+		conn, err := grpc.DialContext(ctx, node.Address(), opts...)
+		if err != nil {
+			return err
+		}
+		defer conn.Close()
+		resp, err := grpc_health_v1.NewHealthClient(conn).Check(ctx, &grpc_health_v1.HealthCheckRequest{Service: service})
+		if err != nil {
+			return err
+		}
+		if resp.Status != grpc_health_v1.HealthCheckResponse_SERVING {
+			return fmt.Errorf("unexpected grpc health status: %s", resp.Status)
+		}
+		return nil
+	}
+}
+
+// HealthCheckConfig 主动健康检查配置
+type HealthCheckConfig struct {
+	// Probe 探测方式，默认为 TCPProbe
+	Probe Probe
+	// Interval 探测间隔，默认 10 秒
+	Interval time.Duration
+	// Timeout 单次探测的超时时间，默认 2 秒
+	Timeout time.Duration
+	// UnhealthyThreshold 连续失败多少次后标记为不健康，默认 2
+	UnhealthyThreshold int
+	// HealthyThreshold 不健康的节点连续成功多少次后恢复，默认 1
+	HealthyThreshold int
+}
+
+type healthState struct {
+	mu        sync.Mutex
+	healthy   bool
+	successes int
+	failures  int
+	cancel    context.CancelFunc
+}
+
+type healthService struct {
+	mu    sync.Mutex
+	nodes map[string]*healthState // <ip:port>
+}
+
+// healthChecker 主动探测注册中心返回的节点，etcd 和 zookeeper 只要租约或会话存活就认为节点可用，
+// 健康检查在本地过滤掉无法提供服务的节点
+type healthChecker struct {
+	config   HealthCheckConfig
+	registry discovery.NodeRegistry
+	services sync.Map // <serviceName, *healthService>
+
+	mu     sync.Mutex
+	closed bool
+	ctx    context.Context
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+}
+
+func newHealthChecker(registry discovery.NodeRegistry, config HealthCheckConfig) *healthChecker {
+	if config.Probe == nil {
+		config.Probe = TCPProbe()
+	}
+	if config.Interval <= 0 {
+		config.Interval = 10 * time.Second
+	}
+	if config.Timeout <= 0 {
+		config.Timeout = 2 * time.Second
+	}
+	if config.UnhealthyThreshold <= 0 {
+		config.UnhealthyThreshold = 2
+	}
+	if config.HealthyThreshold <= 0 {
+		config.HealthyThreshold = 1
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	return &healthChecker{
+		config:   config,
+		registry: registry,
+		ctx:      ctx,
+		cancel:   cancel,
+	}
+}
+
+// filter 过滤掉不健康的节点，首次解析服务时开始监听并探测服务的所有节点
+// 尚未完成探测的节点视为健康
+func (h *healthChecker) filter(serviceName string, nodes []*discovery.ServiceNode) []*discovery.ServiceNode {
+	value, exists := h.services.Load(serviceName)
+	if !exists {
+		value, exists = h.services.LoadOrStore(serviceName, &healthService{nodes: make(map[string]*healthState)})
+		if !exists {
+			service := value.(*healthService)
+			h.spawn(func() { h.watch(serviceName, service) })
+		}
+	}
+	service := value.(*healthService)
+
+	service.mu.Lock()
+	defer service.mu.Unlock()
+	result := make([]*discovery.ServiceNode, 0, len(nodes))
+	for _, node := range nodes {
+		if state := service.nodes[node.Address()]; state == nil || state.isHealthy() {
+			result = append(result, node)
+		}
+	}
+	return result
+}
+
+// watch 监听服务节点变化，为新节点启动探测协程，停止已下线节点的探测
+func (h *healthChecker) watch(serviceName string, service *healthService) {
+	for {
+		events, err := h.registry.Watch(h.ctx, serviceName, nil)
+		if err != nil {
+			log.Printf("failed to watch service %s for health check: %v", serviceName, err)
+		} else {
+			for event := range events {
+				h.sync(service, event.Nodes)
+			}
+		}
+		// 注册中心的监听意外结束时重新监听
+		select {
+		case <-h.ctx.Done():
+			return
+		case <-time.After(h.config.Interval):
+		}
+	}
+}
+
+func (h *healthChecker) sync(service *healthService, nodes []*discovery.ServiceNode) {
+	service.mu.Lock()
+	defer service.mu.Unlock()
+	current := make(map[string]struct{}, len(nodes))
+	for _, node := range nodes {
+		key := node.Address()
+		current[key] = struct{}{}
+		if _, exists := service.nodes[key]; exists {
+			continue
+		}
+		ctx, cancel := context.WithCancel(h.ctx)
+		state := &healthState{healthy: true, cancel: cancel}
+		service.nodes[key] = state
+		node := node
+		h.spawn(func() { h.probe(ctx, node, state) })
+	}
+	for key, state := range service.nodes {
+		if _, exists := current[key]; !exists {
+			state.cancel()
+			delete(service.nodes, key)
+		}
+	}
+}
+
+// probe 定时探测节点，直到节点下线或健康检查关闭
+func (h *healthChecker) probe(ctx context.Context, node *discovery.ServiceNode, state *healthState) {
+	ticker := time.NewTicker(h.config.Interval)
+	defer ticker.Stop()
+	for {
+		probeCtx, cancel := context.WithTimeout(ctx, h.config.Timeout)
+		err := h.config.Probe(probeCtx, node)
+		cancel()
+		if ctx.Err() != nil {
+			return
+		}
+		state.report(err, h.config)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (s *healthState) report(err error, config HealthCheckConfig) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err == nil {
+		s.failures = 0
+		s.successes++
+		if !s.healthy && s.successes >= config.HealthyThreshold {
+			s.healthy = true
+		}
+		return
+	}
+	s.successes = 0
+	s.failures++
+	if s.healthy && s.failures >= config.UnhealthyThreshold {
+		s.healthy = false
+	}
+}
+
+func (s *healthState) isHealthy() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.healthy
+}
+
+// spawn 在健康检查未关闭时启动后台协程，Close 会等待其退出
+func (h *healthChecker) spawn(f func()) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.closed {
+		return
+	}
+	h.wg.Add(1)
+	go func() {
+		defer h.wg.Done()
+		f()
+	}()
+}
+
+// Close 停止所有监听和探测协程
+func (h *healthChecker) Close() {
+	h.mu.Lock()
+	if h.closed {
+		h.mu.Unlock()
+		return
+	}
+	h.closed = true
+	h.mu.Unlock()
+	h.cancel()
+	h.wg.Wait()
+}
@@ -0,0 +1,124 @@
+package client
+
+import (
+	"context"
+	"github.com/stretchr/testify/assert"
+	"github.com/xialeistudio/go-service-discovery/discovery"
+	"github.com/xialeistudio/go-service-discovery/loadbalancer"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/health"
+	"google.golang.org/grpc/health/grpc_health_v1"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+)
+
+// newListenerNode 根据监听地址创建服务节点
+func newListenerNode(t *testing.T, addr net.Addr) *discovery.ServiceNode {
+	host, port, err := net.SplitHostPort(addr.String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	p, _ := strconv.Atoi(port)
+	return &discovery.ServiceNode{ServiceName: "test", IP: net.ParseIP(host), Port: p}
+}
+
+func TestTCPProbe(t *testing.T) {
+	a := assert.New(t)
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	a.Nil(err)
+	node := newListenerNode(t, ln.Addr())
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			_ = conn.Close()
+		}
+	}()
+
+	probe := TCPProbe()
+	a.Nil(probe(context.Background(), node))
+	_ = ln.Close()
+	a.NotNil(probe(context.Background(), node))
+}
+
+func TestHTTPProbe(t *testing.T) {
+	a := assert.New(t)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/health" {
+			w.WriteHeader(http.StatusOK)
+			return
+		}
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+	node := newListenerNode(t, server.Listener.Addr())
+
+	a.Nil(HTTPProbe("/health")(context.Background(), node))
+	a.NotNil(HTTPProbe("/ready")(context.Background(), node))
+}
+
+func TestGRPCProbe(t *testing.T) {
+	a := assert.New(t)
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	a.Nil(err)
+	server := grpc.NewServer()
+	healthServer := health.NewServer()
+	grpc_health_v1.RegisterHealthServer(server, healthServer)
+	go func() { _ = server.Serve(ln) }()
+	defer server.Stop()
+	node := newListenerNode(t, ln.Addr())
+
+	healthServer.SetServingStatus("test", grpc_health_v1.HealthCheckResponse_SERVING)
+	a.Nil(GRPCProbe("test")(context.Background(), node))
+	healthServer.SetServingStatus("test", grpc_health_v1.HealthCheckResponse_NOT_SERVING)
+	a.NotNil(GRPCProbe("test")(context.Background(), node))
+}
+
+func TestClient_Resolve_healthCheck(t *testing.T) {
+	a := assert.New(t)
+	nodes := newTestNodes()
+	var mu sync.Mutex
+	down := map[string]bool{nodes[0].Address(): true}
+	probe := func(_ context.Context, node *discovery.ServiceNode) error {
+		mu.Lock()
+		defer mu.Unlock()
+		if down[node.Address()] {
+			return context.DeadlineExceeded
+		}
+		return nil
+	}
+	c := New(loadbalancer.NewRoundRobin(), &memoryRegistry{nodes: nodes}, WithHealthCheck(HealthCheckConfig{
+		Probe:              probe,
+		Interval:           10 * time.Millisecond,
+		UnhealthyThreshold: 1,
+	}))
+	defer c.Close()
+	ctx := context.Background()
+
+	// 探测失败的节点不再被选择
+	a.Eventually(func() bool {
+		_, _, err := c.Resolve(ctx, "test", WithMinHealthy(3))
+		return err != nil
+	}, time.Second, 10*time.Millisecond)
+	for i := 0; i < 4; i++ {
+		node, _, err := c.Resolve(ctx, "test")
+		a.Nil(err)
+		a.NotEqual(nodes[0], node)
+	}
+
+	// 重新通过探测后恢复
+	mu.Lock()
+	down = map[string]bool{}
+	mu.Unlock()
+	a.Eventually(func() bool {
+		_, _, err := c.Resolve(ctx, "test", WithMinHealthy(3))
+		return err == nil
+	}, time.Second, 10*time.Millisecond)
+}
@@ -0,0 +1,107 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"github.com/xialeistudio/go-service-discovery/discovery"
+	"time"
+)
+
+// WithHedge 启用对冲请求，首次调用 delay 后仍未返回时在另一个节点上发起对冲请求，最先成功的结果生效，其余请求被取消
+// 调用返回可重试的错误时立即发起下一个对冲请求，对冲请求最多 maxHedges 个，与重试共用重试预算
+// 启用对冲后 WithMaxAttempts 和 WithBackoff 不再生效，fn 需要是幂等的
+func WithHedge(delay time.Duration, maxHedges int) CallOption {
+	return func(o *callOptions) {
+		o.hedgeDelay = delay
+		o.maxHedges = maxHedges
+	}
+}
+
+type hedgeResult struct {
+	node *discovery.ServiceNode
+	err  error
+}
+
+// doHedged 以对冲方式调用 fn
+func (c *Client) doHedged(ctx context.Context, serviceName string, fn func(ctx context.Context, node *discovery.ServiceNode) error, o *callOptions, budget *retryBudget) error {
+	hedgeCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	// 已发出的请求在 Do 返回后才结束时不会阻塞
+	results := make(chan hedgeResult, 1+o.maxHedges)
+
+	var tried []*discovery.ServiceNode
+	// running 仍有请求在途的节点，对冲请求不会发往这些节点
+	running := make(map[string]*discovery.ServiceNode)
+	launch := func() error {
+		busy := make([]*discovery.ServiceNode, 0, len(running))
+		for _, node := range running {
+			busy = append(busy, node)
+		}
+		node, done, err := c.resolveUntried(ctx, serviceName, tried, busy, o.resolveOptions)
+		if err != nil {
+			return err
+		}
+		tried = append(tried, node)
+		running[node.Address()] = node
+		go func() {
+			start := time.Now()
+			attemptCtx, bytes := withAttemptBytes(hedgeCtx)
+			err := fn(attemptCtx, node)
+			info := bytes.doneInfo(err, time.Since(start))
+			if err != nil && errors.Is(hedgeCtx.Err(), context.Canceled) && ctx.Err() == nil {
+				// 落选的请求被取消，不作为判断节点好坏的依据
+				info.Err = context.Canceled
+			}
+			done(info)
+			results <- hedgeResult{node: node, err: err}
+		}()
+		return nil
+	}
+	if err := launch(); err != nil {
+		return err
+	}
+
+	timer := time.NewTimer(o.hedgeDelay)
+	defer timer.Stop()
+	inflight, hedges := 1, 0
+	var lastErr error
+	// hedge 发起一个对冲请求，没有可用节点时归还令牌并返回 false
+	hedge := func() bool {
+		if hedges >= o.maxHedges || !budget.withdraw() {
+			return false
+		}
+		if launch() != nil {
+			budget.refund()
+			return false
+		}
+		hedges++
+		inflight++
+		return true
+	}
+	for {
+		select {
+		case result := <-results:
+			inflight--
+			delete(running, result.node.Address())
+			if result.err == nil {
+				return nil
+			}
+			lastErr = result.err
+			if !o.retryable(result.err) || ctx.Err() != nil {
+				return result.err
+			}
+			if !hedge() && inflight == 0 {
+				return lastErr
+			}
+		case <-timer.C:
+			if hedge() {
+				timer.Reset(o.hedgeDelay)
+			}
+		case <-ctx.Done():
+			if lastErr != nil {
+				return lastErr
+			}
+			return ctx.Err()
+		}
+	}
+}
@@ -0,0 +1,135 @@
+package client
+
+import (
+	"context"
+	"github.com/stretchr/testify/assert"
+	"github.com/xialeistudio/go-service-discovery/discovery"
+	"github.com/xialeistudio/go-service-discovery/loadbalancer"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestClient_Do_hedge(t *testing.T) {
+	a := assert.New(t)
+	nodes := newTestNodes()
+	c := New(loadbalancer.NewRoundRobin(), &memoryRegistry{nodes: nodes})
+	ctx := context.Background()
+
+	t.Run("Slow node is hedged", func(t *testing.T) {
+		var mu sync.Mutex
+		var called []*discovery.ServiceNode
+		canceled := make(chan struct{})
+		err := c.Do(ctx, "test", func(ctx context.Context, node *discovery.ServiceNode) error {
+			mu.Lock()
+			called = append(called, node)
+			first := len(called) == 1
+			mu.Unlock()
+			if first {
+				// 首次调用很慢，落选后被取消
+				<-ctx.Done()
+				close(canceled)
+				return ctx.Err()
+			}
+			return nil
+		}, WithHedge(10*time.Millisecond, 1))
+		a.Nil(err)
+		select {
+		case <-canceled:
+		case <-time.After(time.Second):
+			t.Fatal("losing attempt was not canceled")
+		}
+		mu.Lock()
+		defer mu.Unlock()
+		a.Len(called, 2)
+		a.NotEqual(called[0], called[1])
+	})
+	t.Run("Fast node is not hedged", func(t *testing.T) {
+		calls := 0
+		err := c.Do(ctx, "test", func(context.Context, *discovery.ServiceNode) error {
+			calls++
+			return nil
+		}, WithHedge(time.Second, 2))
+		a.Nil(err)
+		a.Equal(1, calls)
+	})
+	t.Run("Hedge immediately on failure", func(t *testing.T) {
+		var mu sync.Mutex
+		calls := 0
+		start := time.Now()
+		err := c.Do(ctx, "test", func(context.Context, *discovery.ServiceNode) error {
+			mu.Lock()
+			defer mu.Unlock()
+			calls++
+			return errTest
+		}, WithHedge(time.Second, 2))
+		a.ErrorIs(err, errTest)
+		a.Equal(3, calls)
+		a.Less(time.Since(start), time.Second)
+	})
+	t.Run("Losing attempt reported as canceled", func(t *testing.T) {
+		lb := &notifyBalancer{inner: loadbalancer.NewRoundRobin(), infos: make(chan loadbalancer.DoneInfo, 2)}
+		c := New(lb, &memoryRegistry{nodes: nodes})
+		var mu sync.Mutex
+		calls := 0
+		err := c.Do(ctx, "test", func(ctx context.Context, node *discovery.ServiceNode) error {
+			mu.Lock()
+			calls++
+			first := calls == 1
+			mu.Unlock()
+			if first {
+				<-ctx.Done()
+				return ctx.Err()
+			}
+			return nil
+		}, WithHedge(10*time.Millisecond, 1))
+		a.Nil(err)
+		var errs []error
+		for i := 0; i < 2; i++ {
+			select {
+			case info := <-lb.infos:
+				errs = append(errs, info.Err)
+			case <-time.After(time.Second):
+				t.Fatal("timeout waiting for done")
+			}
+		}
+		a.ElementsMatch([]error{nil, context.Canceled}, errs)
+	})
+	t.Run("Busy node is not hedged", func(t *testing.T) {
+		c := New(loadbalancer.NewRoundRobin(), &memoryRegistry{nodes: nodes[:2]})
+		var mu sync.Mutex
+		var called []*discovery.ServiceNode
+		err := c.Do(ctx, "test", func(ctx context.Context, node *discovery.ServiceNode) error {
+			mu.Lock()
+			called = append(called, node)
+			first := len(called) == 1
+			mu.Unlock()
+			if first {
+				time.Sleep(50 * time.Millisecond)
+				return nil
+			}
+			<-ctx.Done()
+			return ctx.Err()
+		}, WithHedge(5*time.Millisecond, 2))
+		a.Nil(err)
+		mu.Lock()
+		defer mu.Unlock()
+		a.ElementsMatch(nodes[:2], called)
+		// 没有发出的对冲请求归还令牌
+		a.Equal(float64(c.retryBudget.MaxTokens)-1, c.budget("test").tokens)
+	})
+}
+
+// notifyBalancer 通过 channel 通知请求结果的负载均衡器
+type notifyBalancer struct {
+	inner loadbalancer.LoadBalancer
+	infos chan loadbalancer.DoneInfo
+}
+
+func (n *notifyBalancer) Select(ctx context.Context, serviceName string, nodes []*discovery.ServiceNode) (*discovery.ServiceNode, loadbalancer.DoneFunc) {
+	node, done := n.inner.Select(ctx, serviceName, nodes)
+	return node, func(info loadbalancer.DoneInfo) {
+		done(info)
+		n.infos <- info
+	}
+}
@@ -0,0 +1,137 @@
+package client
+
+import (
+	"context"
+	"fmt"
+	"github.com/xialeistudio/go-service-discovery/discovery"
+	"net/http"
+	"strings"
+)
+
+// TagsHeader 请求头中指定节点标签，格式为 key1=value1,key2=value2，转发前会被移除
+const TagsHeader = "X-Discovery-Tags"
+
+type resolveOptionsKey struct{}
+
+// ContextWithResolveOptions 在 ctx 中携带解析选项，Transport 和 Dialer 解析节点时使用
+func ContextWithResolveOptions(ctx context.Context, opts ...ResolveOption) context.Context {
+	return context.WithValue(ctx, resolveOptionsKey{}, append(resolveOptionsFromContext(ctx), opts...))
+}
+
+func resolveOptionsFromContext(ctx context.Context) []ResolveOption {
+	opts, _ := ctx.Value(resolveOptionsKey{}).([]ResolveOption)
+	return opts[:len(opts):len(opts)]
+}
+
+// statusError 服务节点返回了表示暂时不可用的状态码
+type statusError struct {
+	code int
+}
+
+func (e *statusError) Error() string {
+	return fmt.Sprintf("unexpected http status: %d", e.code)
+}
+
+// Transport 把 http://service-name/path 形式的请求解析到服务节点后转发，URL 中的主机名为服务名，端口被忽略，Host 请求头保持为服务名
+// 节点返回 502、503、504 或请求出错时反馈为失败，幂等请求会在其他节点上重试
+type Transport struct {
+	Client *Client
+	// Base 实际发送请求的 RoundTripper，默认为 http.DefaultTransport
+	Base http.RoundTripper
+	// MaxAttempts 幂等请求最多尝试次数，默认 3
+	MaxAttempts int
+}
+
+// RoundTrip 实现 http.RoundTripper
+func (t *Transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	base := t.Base
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	maxAttempts := t.MaxAttempts
+	if maxAttempts <= 0 {
+		maxAttempts = 3
+	}
+	if !isReplayable(req) {
+		maxAttempts = 1
+	}
+
+	ctx := req.Context()
+	opts := resolveOptionsFromContext(ctx)
+	if header := req.Header.Get(TagsHeader); header != "" {
+		opts = append(opts, WithTags(parseTags(header)))
+	}
+
+	var resp *http.Response
+	attempts := 0
+	bodySent := false
+	err := t.Client.Do(ctx, req.URL.Hostname(), func(ctx context.Context, node *discovery.ServiceNode) error {
+		if resp != nil {
+			// 丢弃上一次失败的响应
+			_ = resp.Body.Close()
+			resp = nil
+		}
+		out := req.Clone(ctx)
+		out.URL.Host = node.Address()
+		out.Header.Del(TagsHeader)
+		if attempts > 0 && req.GetBody != nil {
+			body, err := req.GetBody()
+			if err != nil {
+				return err
+			}
+			out.Body = body
+		}
+		attempts++
+
+		bodySent = bodySent || out.Body == req.Body
+		r, err := base.RoundTrip(out)
+		if err != nil {
+			return err
+		}
+		resp = r
+		// 按请求和响应声明的长度反馈字节数，长度未知时不计
+		ReportBytes(ctx, max(out.ContentLength, 0), max(r.ContentLength, 0))
+		switch r.StatusCode {
+		case http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+			return &statusError{code: r.StatusCode}
+		}
+		return nil
+	}, WithMaxAttempts(maxAttempts), WithResolveOptions(opts...))
+	if resp != nil {
+		// 最后一次尝试返回的错误状态码原样交给调用方
+		return resp, nil
+	}
+	if !bodySent && req.Body != nil {
+		// RoundTripper 需要在出错时也关闭请求体
+		_ = req.Body.Close()
+	}
+	return nil, err
+}
+
+// isReplayable 幂等且请求体可以重复读取的请求才能重试
+func isReplayable(req *http.Request) bool {
+	if req.Body != nil && req.Body != http.NoBody && req.GetBody == nil {
+		return false
+	}
+	switch req.Method {
+	case "", http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodTrace, http.MethodPut, http.MethodDelete:
+		return true
+	}
+	return req.Header.Get("Idempotency-Key") != "" || req.Header.Get("X-Idempotency-Key") != ""
+}
+
+func parseTags(header string) map[string]string {
+	tags := make(map[string]string)
+	for _, pair := range strings.Split(header, ",") {
+		name, value, _ := strings.Cut(pair, "=")
+		if name = strings.TrimSpace(name); name != "" {
+			tags[name] = strings.TrimSpace(value)
+		}
+	}
+	return tags
+}
+
+// NewHTTPClient 创建通过服务发现转发请求的 http.Client
+func NewHTTPClient(c *Client) *http.Client {
+	return &http.Client{Transport: &Transport{Client: c}}
+}
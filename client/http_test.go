@@ -0,0 +1,132 @@
+package client
+
+import (
+	"context"
+	"github.com/stretchr/testify/assert"
+	"github.com/xialeistudio/go-service-discovery/discovery"
+	"github.com/xialeistudio/go-service-discovery/loadbalancer"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+)
+
+// newHTTPTestNode 启动 http 服务并返回对应的服务节点
+func newHTTPTestNode(t *testing.T, version string, handler http.HandlerFunc) *discovery.ServiceNode {
+	server := httptest.NewServer(handler)
+	t.Cleanup(server.Close)
+	node := newListenerNode(t, server.Listener.Addr())
+	node.Tags = map[string]string{"version": version}
+	return node
+}
+
+func TestTransport(t *testing.T) {
+	a := assert.New(t)
+	var unavailableCalls int32
+	unavailable := newHTTPTestNode(t, "1.0", func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&unavailableCalls, 1)
+		w.WriteHeader(http.StatusServiceUnavailable)
+	})
+	ok := newHTTPTestNode(t, "2.0", func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		_, _ = io.WriteString(w, r.Method+" "+r.Host+r.URL.Path+" "+string(body)+r.Header.Get(TagsHeader))
+	})
+	c := New(loadbalancer.NewRoundRobin(), &memoryRegistry{nodes: []*discovery.ServiceNode{unavailable, ok}})
+	httpClient := NewHTTPClient(c)
+
+	readBody := func(resp *http.Response) string {
+		defer resp.Body.Close()
+		body, _ := io.ReadAll(resp.Body)
+		return string(body)
+	}
+
+	t.Run("Retry idempotent request", func(t *testing.T) {
+		for i := 0; i < 2; i++ {
+			resp, err := httpClient.Get("http://test/hello")
+			a.Nil(err)
+			a.Equal(http.StatusOK, resp.StatusCode)
+			a.Equal("GET test/hello ", readBody(resp))
+		}
+	})
+	t.Run("Retry request with replayable body", func(t *testing.T) {
+		for i := 0; i < 2; i++ {
+			req, _ := http.NewRequest(http.MethodPut, "http://test/hello", strings.NewReader("body"))
+			resp, err := httpClient.Do(req)
+			a.Nil(err)
+			a.Equal("PUT test/hello body", readBody(resp))
+		}
+	})
+	t.Run("Do not retry non-idempotent request", func(t *testing.T) {
+		atomic.StoreInt32(&unavailableCalls, 0)
+		statuses := map[int]int{}
+		for i := 0; i < 2; i++ {
+			resp, err := httpClient.Post("http://test/hello", "text/plain", strings.NewReader("body"))
+			a.Nil(err)
+			statuses[resp.StatusCode]++
+			_ = resp.Body.Close()
+		}
+		a.Equal(map[int]int{http.StatusOK: 1, http.StatusServiceUnavailable: 1}, statuses)
+		a.Equal(int32(1), atomic.LoadInt32(&unavailableCalls))
+	})
+	t.Run("Select by tags header", func(t *testing.T) {
+		req, _ := http.NewRequest(http.MethodGet, "http://test/hello", nil)
+		req.Header.Set(TagsHeader, "version=1.0")
+		resp, err := httpClient.Do(req)
+		a.Nil(err)
+		a.Equal(http.StatusServiceUnavailable, resp.StatusCode)
+		_ = resp.Body.Close()
+	})
+	t.Run("Select by context", func(t *testing.T) {
+		ctx := ContextWithResolveOptions(context.Background(), WithTags(map[string]string{"version": "2.0"}))
+		req, _ := http.NewRequestWithContext(ctx, http.MethodPost, "http://test/hello", nil)
+		resp, err := httpClient.Do(req)
+		a.Nil(err)
+		a.Equal("POST test/hello ", readBody(resp))
+	})
+	t.Run("Single unavailable node", func(t *testing.T) {
+		atomic.StoreInt32(&unavailableCalls, 0)
+		c := New(loadbalancer.NewRoundRobin(), &memoryRegistry{nodes: []*discovery.ServiceNode{unavailable}})
+		resp, err := NewHTTPClient(c).Get("http://test/hello")
+		a.Nil(err)
+		a.Equal(http.StatusServiceUnavailable, resp.StatusCode)
+		_ = resp.Body.Close()
+		// 没有其他节点可以重试时直接返回，不消耗重试预算
+		a.EqualValues(1, atomic.LoadInt32(&unavailableCalls))
+		a.Equal(float64(c.retryBudget.MaxTokens), c.budget("test").tokens)
+	})
+	t.Run("Report bytes", func(t *testing.T) {
+		lb := &recordBalancer{}
+		c := New(lb, &memoryRegistry{nodes: []*discovery.ServiceNode{ok}})
+		req, _ := http.NewRequest(http.MethodPut, "http://test/hello", strings.NewReader("body"))
+		resp, err := NewHTTPClient(c).Do(req)
+		a.Nil(err)
+		a.Equal("PUT test/hello body", readBody(resp))
+		a.Len(lb.infos, 1)
+		a.Equal(int64(len("body")), lb.infos[0].BytesSent)
+		a.Equal(int64(len("PUT test/hello body")), lb.infos[0].BytesReceived)
+	})
+	t.Run("Unknown service", func(t *testing.T) {
+		_, err := httpClient.Get("http://unknown/hello")
+		a.ErrorIs(err, ErrNoAvailableNode)
+	})
+	t.Run("Close body when no node is available", func(t *testing.T) {
+		body := &closeRecorder{Reader: strings.NewReader("body")}
+		req, _ := http.NewRequest(http.MethodPost, "http://test/hello", body)
+		_, err := (&Transport{Client: New(loadbalancer.NewRoundRobin(), &memoryRegistry{})}).RoundTrip(req)
+		a.ErrorIs(err, ErrNoAvailableNode)
+		a.True(body.closed)
+	})
+}
+
+// closeRecorder 记录是否被关闭的请求体
+type closeRecorder struct {
+	io.Reader
+	closed bool
+}
+
+func (r *closeRecorder) Close() error {
+	r.closed = true
+	return nil
+}
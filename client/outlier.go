@@ -0,0 +1,188 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"github.com/xialeistudio/go-service-discovery/discovery"
+	"sync"
+	"time"
+)
+
+// OutlierConfig 异常节点检测配置
+type OutlierConfig struct {
+	// ConsecutiveFailures 连续失败多少次后驱逐节点，默认 5
+	ConsecutiveFailures int
+	// FailureRate 统计周期内失败率达到该值时驱逐节点，默认 0.5
+	FailureRate float64
+	// MinRequests 统计周期内请求数不少于该值时才按失败率驱逐，默认 10
+	MinRequests int
+	// Interval 失败率的统计周期，默认 10 秒
+	Interval time.Duration
+	// BaseEjectionTime 驱逐时长，第 n 次驱逐的时长为 n*BaseEjectionTime，默认 30 秒
+	BaseEjectionTime time.Duration
+	// MaxEjectionTime 驱逐时长的上限，默认 5 分钟
+	MaxEjectionTime time.Duration
+	// MaxEjectionPercent 同时被驱逐的节点占比上限，默认 50，至少允许驱逐一个节点，但不会驱逐全部节点
+	MaxEjectionPercent int
+}
+
+type outlierNode struct {
+	consecutiveFailures int
+	requests            int
+	failures            int
+	windowStart         time.Time
+	ejectedUntil        time.Time
+	ejections           int // 驱逐次数，决定下一次驱逐的时长，节点持续正常时逐渐减少
+}
+
+type outlierService struct {
+	mu        sync.Mutex
+	total     int                     // 最近一次解析时的节点数
+	nodes     map[string]*outlierNode // <ip:port>
+	lastPrune time.Time
+}
+
+// outlierDetector 根据调用结果被动检测异常节点，在注册中心的健康检查生效之前停止向其发送请求
+type outlierDetector struct {
+	config   OutlierConfig
+	now      func() time.Time
+	services sync.Map // <serviceName, *outlierService>
+}
+
+func newOutlierDetector(config OutlierConfig) *outlierDetector {
+	if config.ConsecutiveFailures <= 0 {
+		config.ConsecutiveFailures = 5
+	}
+	if config.FailureRate <= 0 || config.FailureRate > 1 {
+		config.FailureRate = 0.5
+	}
+	if config.MinRequests <= 0 {
+		config.MinRequests = 10
+	}
+	if config.Interval <= 0 {
+		config.Interval = 10 * time.Second
+	}
+	if config.BaseEjectionTime <= 0 {
+		config.BaseEjectionTime = 30 * time.Second
+	}
+	if config.MaxEjectionTime <= 0 {
+		config.MaxEjectionTime = 5 * time.Minute
+	}
+	if config.MaxEjectionPercent <= 0 || config.MaxEjectionPercent > 100 {
+		config.MaxEjectionPercent = 50
+	}
+	return &outlierDetector{config: config, now: time.Now}
+}
+
+func (d *outlierDetector) service(serviceName string) *outlierService {
+	value, exists := d.services.Load(serviceName)
+	if !exists {
+		value, _ = d.services.LoadOrStore(serviceName, &outlierService{nodes: make(map[string]*outlierNode)})
+	}
+	return value.(*outlierService)
+}
+
+// filter 过滤掉处于驱逐期的节点
+func (d *outlierDetector) filter(serviceName string, nodes []*discovery.ServiceNode) []*discovery.ServiceNode {
+	service := d.service(serviceName)
+	now := d.now()
+
+	service.mu.Lock()
+	defer service.mu.Unlock()
+	service.total = len(nodes)
+	result := make([]*discovery.ServiceNode, 0, len(nodes))
+	for _, node := range nodes {
+		if state := service.nodes[node.Address()]; state != nil && now.Before(state.ejectedUntil) {
+			continue
+		}
+		result = append(result, node)
+	}
+	d.prune(service, now)
+	if len(result) == 0 {
+		// 节点数减少后可能全部处于驱逐期，此时忽略驱逐
+		return nodes
+	}
+	return result
+}
+
+// prune 每个统计周期清理一次长时间正常的节点状态，避免下线节点的状态一直保留
+func (d *outlierDetector) prune(service *outlierService, now time.Time) {
+	if now.Sub(service.lastPrune) < d.config.Interval {
+		return
+	}
+	service.lastPrune = now
+	for key, state := range service.nodes {
+		if now.Sub(state.windowStart) >= d.config.Interval && now.Sub(state.ejectedUntil) >= d.config.MaxEjectionTime {
+			delete(service.nodes, key)
+		}
+	}
+}
+
+// report 记录一次调用结果，被取消的请求不计入统计
+func (d *outlierDetector) report(serviceName string, node *discovery.ServiceNode, err error) {
+	if errors.Is(err, context.Canceled) {
+		return
+	}
+	service := d.service(serviceName)
+	now := d.now()
+
+	service.mu.Lock()
+	defer service.mu.Unlock()
+	key := node.Address()
+	state := service.nodes[key]
+	if state == nil {
+		state = &outlierNode{windowStart: now}
+		service.nodes[key] = state
+	}
+	if now.Sub(state.windowStart) >= d.config.Interval {
+		// 新的统计周期，未被驱逐的节点逐渐恢复驱逐次数
+		if state.ejections > 0 && !now.Before(state.ejectedUntil.Add(d.config.Interval)) {
+			state.ejections--
+		}
+		state.windowStart, state.requests, state.failures = now, 0, 0
+	}
+	if now.Before(state.ejectedUntil) {
+		// 驱逐期内仍在进行的请求不再重复驱逐
+		return
+	}
+
+	state.requests++
+	if err == nil {
+		state.consecutiveFailures = 0
+		return
+	}
+	state.failures++
+	state.consecutiveFailures++
+	if state.consecutiveFailures < d.config.ConsecutiveFailures &&
+		(state.requests < d.config.MinRequests || float64(state.failures) < d.config.FailureRate*float64(state.requests)) {
+		return
+	}
+	if !d.canEject(service, now) {
+		return
+	}
+	state.ejections++
+	ejectionTime := time.Duration(state.ejections) * d.config.BaseEjectionTime
+	if ejectionTime > d.config.MaxEjectionTime {
+		ejectionTime = d.config.MaxEjectionTime
+	}
+	state.ejectedUntil = now.Add(ejectionTime)
+	state.consecutiveFailures, state.requests, state.failures = 0, 0, 0
+}
+
+// canEject 检查驱逐比例上限
+func (d *outlierDetector) canEject(service *outlierService, now time.Time) bool {
+	ejected := 0
+	for _, state := range service.nodes {
+		if now.Before(state.ejectedUntil) {
+			ejected++
+		}
+	}
+	limit := service.total * d.config.MaxEjectionPercent / 100
+	if limit < 1 {
+		limit = 1
+	}
+	if limit > service.total-1 {
+		limit = service.total - 1
+	}
+	return ejected < limit
+}
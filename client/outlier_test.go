@@ -0,0 +1,113 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/xialeistudio/go-service-discovery/loadbalancer"
+	"testing"
+	"time"
+)
+
+var errTest = errors.New("test error")
+
+func Test_outlierDetector_consecutiveFailures(t *testing.T) {
+	a := assert.New(t)
+	now := time.Now()
+	d := newOutlierDetector(OutlierConfig{ConsecutiveFailures: 3, BaseEjectionTime: time.Minute})
+	d.now = func() time.Time { return now }
+	nodes := newTestNodes()
+	a.Len(d.filter("test", nodes), 3)
+
+	// 成功的请求重置连续失败次数
+	d.report("test", nodes[0], errTest)
+	d.report("test", nodes[0], errTest)
+	d.report("test", nodes[0], nil)
+	d.report("test", nodes[0], errTest)
+	d.report("test", nodes[0], errTest)
+	a.Len(d.filter("test", nodes), 3)
+
+	// 被取消的请求不计入统计
+	d.report("test", nodes[0], context.Canceled)
+	a.Len(d.filter("test", nodes), 3)
+
+	d.report("test", nodes[0], errTest)
+	a.Equal(nodes[1:], d.filter("test", nodes))
+
+	// 驱逐期结束后恢复
+	now = now.Add(time.Minute)
+	a.Len(d.filter("test", nodes), 3)
+
+	// 再次驱逐的时长加倍
+	for i := 0; i < 3; i++ {
+		d.report("test", nodes[0], errTest)
+	}
+	now = now.Add(time.Minute)
+	a.Equal(nodes[1:], d.filter("test", nodes))
+	now = now.Add(time.Minute)
+	a.Len(d.filter("test", nodes), 3)
+}
+
+func Test_outlierDetector_failureRate(t *testing.T) {
+	a := assert.New(t)
+	now := time.Now()
+	d := newOutlierDetector(OutlierConfig{ConsecutiveFailures: 100, FailureRate: 0.5, MinRequests: 10, Interval: time.Second})
+	d.now = func() time.Time { return now }
+	nodes := newTestNodes()
+
+	// 请求数不足时不按失败率驱逐
+	for i := 0; i < 4; i++ {
+		d.report("test", nodes[1], nil)
+		d.report("test", nodes[1], errTest)
+	}
+	a.Len(d.filter("test", nodes), 3)
+
+	// 新的统计周期重新计数
+	now = now.Add(time.Second)
+	for i := 0; i < 4; i++ {
+		d.report("test", nodes[1], nil)
+		d.report("test", nodes[1], errTest)
+	}
+	a.Len(d.filter("test", nodes), 3)
+	d.report("test", nodes[1], nil)
+	d.report("test", nodes[1], errTest)
+	a.NotContains(d.filter("test", nodes), nodes[1])
+}
+
+func Test_outlierDetector_maxEjectionPercent(t *testing.T) {
+	a := assert.New(t)
+	d := newOutlierDetector(OutlierConfig{ConsecutiveFailures: 1})
+	nodes := newTestNodes()
+	a.Len(d.filter("test", nodes), 3)
+
+	// 3 个节点最多驱逐 1 个
+	for _, node := range nodes {
+		d.report("test", node, errTest)
+	}
+	a.Equal(nodes[1:], d.filter("test", nodes))
+
+	// 只有一个节点时不驱逐
+	a.Len(d.filter("test", nodes[1:2]), 1)
+	d.report("test", nodes[1], errTest)
+	a.Equal(nodes[1:2], d.filter("test", nodes[1:2]))
+}
+
+func TestClient_Resolve_outlier(t *testing.T) {
+	a := assert.New(t)
+	nodes := newTestNodes()
+	c := New(loadbalancer.NewRoundRobin(), &memoryRegistry{nodes: nodes}, WithOutlierDetection(OutlierConfig{ConsecutiveFailures: 2}))
+	ctx := context.Background()
+
+	for i := 0; i < 2; i++ {
+		node, done, err := c.Resolve(ctx, "test", WithTags(map[string]string{"version": "1.0"}))
+		a.Nil(err)
+		done(loadbalancer.DoneInfo{Err: errTest})
+		node, done, err = c.Resolve(ctx, "test", WithExclude(node), WithTags(map[string]string{"version": "1.0"}))
+		a.Nil(err)
+		done(loadbalancer.DoneInfo{})
+	}
+
+	// 连续失败的节点被驱逐，不计入可用节点
+	_, _, err := c.Resolve(ctx, "test", WithTags(map[string]string{"version": "1.0"}), WithMinHealthy(2))
+	a.ErrorIs(err, ErrInsufficientNodes)
+}
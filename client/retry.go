@@ -0,0 +1,237 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"github.com/xialeistudio/go-service-discovery/discovery"
+	"github.com/xialeistudio/go-service-discovery/loadbalancer"
+	"math/rand"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// RetryBudgetConfig 重试预算，每个请求存入 Ratio 个令牌，每次重试消耗一个令牌，避免故障时重试放大流量
+type RetryBudgetConfig struct {
+	// Ratio 重试数占请求数的比例上限，默认 0.2
+	Ratio float64
+	// MaxTokens 令牌桶容量，即允许的突发重试数，默认 10
+	MaxTokens int
+}
+
+// retryBudget 单个服务的重试预算
+type retryBudget struct {
+	mu     sync.Mutex
+	tokens float64
+}
+
+func (b *retryBudget) deposit(config RetryBudgetConfig) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.tokens += config.Ratio
+	if b.tokens > float64(config.MaxTokens) {
+		b.tokens = float64(config.MaxTokens)
+	}
+}
+
+func (b *retryBudget) withdraw() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.tokens < 1 {
+		return false
+	}
+	b.tokens--
+	return true
+}
+
+// refund 归还 withdraw 取出但没有使用的令牌
+func (b *retryBudget) refund() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.tokens++
+}
+
+// WithRetryBudget 设置 Do 的重试预算，每个服务单独计算
+func WithRetryBudget(config RetryBudgetConfig) Option {
+	return func(c *Client) {
+		if config.Ratio <= 0 {
+			config.Ratio = 0.2
+		}
+		if config.MaxTokens <= 0 {
+			config.MaxTokens = 10
+		}
+		c.retryBudget = config
+	}
+}
+
+func (c *Client) budget(serviceName string) *retryBudget {
+	value, exists := c.budgets.Load(serviceName)
+	if !exists {
+		value, _ = c.budgets.LoadOrStore(serviceName, &retryBudget{tokens: float64(c.retryBudget.MaxTokens)})
+	}
+	return value.(*retryBudget)
+}
+
+// CallOption Do 的调用选项
+type CallOption func(o *callOptions)
+
+type callOptions struct {
+	maxAttempts    int
+	baseBackoff    time.Duration
+	maxBackoff     time.Duration
+	retryable      func(err error) bool
+	resolveOptions []ResolveOption
+	hedgeDelay     time.Duration
+	maxHedges      int
+}
+
+// WithMaxAttempts 最多尝试次数，包括首次调用，默认 3
+func WithMaxAttempts(n int) CallOption {
+	return func(o *callOptions) {
+		o.maxAttempts = n
+	}
+}
+
+// WithBackoff 重试的退避时间，第 n 次重试等待 [0, min(max, base*2^(n-1))) 内的随机时间，默认 base 为 50 毫秒，max 为 1 秒
+func WithBackoff(base, max time.Duration) CallOption {
+	return func(o *callOptions) {
+		o.baseBackoff = base
+		o.maxBackoff = max
+	}
+}
+
+// WithRetryable 判断错误是否可以重试，默认所有错误都可以重试
+func WithRetryable(retryable func(err error) bool) CallOption {
+	return func(o *callOptions) {
+		o.retryable = retryable
+	}
+}
+
+// WithResolveOptions 每次尝试解析节点时使用的选项
+func WithResolveOptions(opts ...ResolveOption) CallOption {
+	return func(o *callOptions) {
+		o.resolveOptions = append(o.resolveOptions, opts...)
+	}
+}
+
+type attemptBytesKey struct{}
+
+// attemptBytes 单次调用发送和接收的字节数
+type attemptBytes struct {
+	sent     atomic.Int64
+	received atomic.Int64
+}
+
+// ReportBytes 在 Do 的 fn 中报告本次调用发送和接收的字节数，随调用结果反馈给负载均衡器，多次调用时累加
+func ReportBytes(ctx context.Context, sent, received int64) {
+	if bytes, ok := ctx.Value(attemptBytesKey{}).(*attemptBytes); ok {
+		bytes.sent.Add(sent)
+		bytes.received.Add(received)
+	}
+}
+
+// withAttemptBytes 返回记录单次调用字节数的 ctx
+func withAttemptBytes(ctx context.Context) (context.Context, *attemptBytes) {
+	bytes := &attemptBytes{}
+	return context.WithValue(ctx, attemptBytesKey{}, bytes), bytes
+}
+
+func (b *attemptBytes) doneInfo(err error, latency time.Duration) loadbalancer.DoneInfo {
+	return loadbalancer.DoneInfo{Err: err, Latency: latency, BytesSent: b.sent.Load(), BytesReceived: b.received.Load()}
+}
+
+// backoff 第 attempt 次重试的退避时间
+func (o *callOptions) backoff(attempt int) time.Duration {
+	backoff := o.maxBackoff
+	if shift := attempt - 1; shift < 32 && o.baseBackoff<<shift < o.maxBackoff {
+		backoff = o.baseBackoff << shift
+	}
+	if backoff <= 0 {
+		return 0
+	}
+	return time.Duration(rand.Int63n(int64(backoff)))
+}
+
+// Do 选择服务节点调用 fn，失败时在其他节点上重试
+// 重试受 WithMaxAttempts、重试预算和 ctx 的截止时间限制，返回最后一次调用的错误
+func (c *Client) Do(ctx context.Context, serviceName string, fn func(ctx context.Context, node *discovery.ServiceNode) error, opts ...CallOption) error {
+	o := &callOptions{
+		maxAttempts: 3,
+		baseBackoff: 50 * time.Millisecond,
+		maxBackoff:  time.Second,
+		retryable:   func(err error) bool { return true },
+	}
+	for _, opt := range opts {
+		opt(o)
+	}
+	budget := c.budget(serviceName)
+	budget.deposit(c.retryBudget)
+	if o.maxHedges > 0 {
+		return c.doHedged(ctx, serviceName, fn, o, budget)
+	}
+
+	var tried []*discovery.ServiceNode
+	var lastErr error
+	for attempt := 0; attempt < o.maxAttempts; attempt++ {
+		if attempt > 0 && !o.retryable(lastErr) {
+			return lastErr
+		}
+
+		// 先选出重试的节点，没有可用节点时不消耗令牌，也不等待退避时间
+		node, done, err := c.resolveUntried(ctx, serviceName, tried, nil, o.resolveOptions)
+		if err != nil {
+			if lastErr != nil {
+				return lastErr
+			}
+			return err
+		}
+		if attempt > 0 {
+			if !budget.withdraw() {
+				done(loadbalancer.DoneInfo{Err: context.Canceled})
+				return lastErr
+			}
+			if !sleep(ctx, o.backoff(attempt)) {
+				budget.refund()
+				done(loadbalancer.DoneInfo{Err: context.Canceled})
+				return lastErr
+			}
+		}
+		tried = append(tried, node)
+
+		start := time.Now()
+		attemptCtx, bytes := withAttemptBytes(ctx)
+		lastErr = fn(attemptCtx, node)
+		done(bytes.doneInfo(lastErr, time.Since(start)))
+		if lastErr == nil || ctx.Err() != nil {
+			return lastErr
+		}
+	}
+	return lastErr
+}
+
+// resolveUntried 优先选择未尝试过的节点，全部尝试过时只排除最近一次尝试的节点，busy 中的节点始终排除
+func (c *Client) resolveUntried(ctx context.Context, serviceName string, tried, busy []*discovery.ServiceNode, resolveOptions []ResolveOption) (*discovery.ServiceNode, loadbalancer.DoneFunc, error) {
+	if len(tried) == 0 && len(busy) == 0 {
+		return c.Resolve(ctx, serviceName, resolveOptions...)
+	}
+	node, done, err := c.Resolve(ctx, serviceName, append(resolveOptions[:len(resolveOptions):len(resolveOptions)], WithExclude(tried...), WithExclude(busy...))...)
+	if errors.Is(err, ErrNoAvailableNode) && len(tried) > 1 {
+		node, done, err = c.Resolve(ctx, serviceName, append(resolveOptions[:len(resolveOptions):len(resolveOptions)], WithExclude(tried[len(tried)-1]), WithExclude(busy...))...)
+	}
+	return node, done, err
+}
+
+// sleep 等待 d，ctx 结束或剩余时间不足 d 时返回 false
+func sleep(ctx context.Context, d time.Duration) bool {
+	if deadline, ok := ctx.Deadline(); ok && time.Until(deadline) < d {
+		return false
+	}
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return false
+	case <-timer.C:
+		return true
+	}
+}
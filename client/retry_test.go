@@ -0,0 +1,132 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/xialeistudio/go-service-discovery/discovery"
+	"github.com/xialeistudio/go-service-discovery/loadbalancer"
+	"testing"
+	"time"
+)
+
+func TestClient_Do(t *testing.T) {
+	a := assert.New(t)
+	nodes := newTestNodes()
+	c := New(loadbalancer.NewRoundRobin(), &memoryRegistry{nodes: nodes})
+	ctx := context.Background()
+	noBackoff := WithBackoff(0, 0)
+
+	t.Run("Retry on other nodes", func(t *testing.T) {
+		var called []*discovery.ServiceNode
+		err := c.Do(ctx, "test", func(_ context.Context, node *discovery.ServiceNode) error {
+			called = append(called, node)
+			if len(called) < 3 {
+				return errTest
+			}
+			return nil
+		}, noBackoff)
+		a.Nil(err)
+		a.Len(called, 3)
+		a.ElementsMatch(nodes, called)
+	})
+	t.Run("Retry on the same node set", func(t *testing.T) {
+		var called []*discovery.ServiceNode
+		err := c.Do(ctx, "test", func(_ context.Context, node *discovery.ServiceNode) error {
+			called = append(called, node)
+			return errTest
+		}, noBackoff, WithMaxAttempts(4), WithResolveOptions(WithTags(map[string]string{"version": "1.0"})))
+		a.ErrorIs(err, errTest)
+		a.Len(called, 4)
+		// 全部节点都尝试过后不会连续选择同一个节点
+		for i := 1; i < len(called); i++ {
+			a.NotEqual(called[i-1], called[i])
+		}
+	})
+	t.Run("Not retryable", func(t *testing.T) {
+		errPermanent := errors.New("permanent")
+		calls := 0
+		err := c.Do(ctx, "test", func(context.Context, *discovery.ServiceNode) error {
+			calls++
+			return errPermanent
+		}, noBackoff, WithRetryable(func(err error) bool {
+			return !errors.Is(err, errPermanent)
+		}))
+		a.ErrorIs(err, errPermanent)
+		a.Equal(1, calls)
+	})
+	t.Run("Context deadline", func(t *testing.T) {
+		ctx, cancel := context.WithTimeout(ctx, 50*time.Millisecond)
+		defer cancel()
+		calls := 0
+		err := c.Do(ctx, "test", func(context.Context, *discovery.ServiceNode) error {
+			calls++
+			return errTest
+		}, WithBackoff(time.Hour, time.Hour))
+		a.ErrorIs(err, errTest)
+		a.Equal(1, calls)
+	})
+	t.Run("Unknown service", func(t *testing.T) {
+		err := c.Do(ctx, "unknown", func(context.Context, *discovery.ServiceNode) error {
+			return nil
+		})
+		a.ErrorIs(err, ErrNoAvailableNode)
+	})
+}
+
+func TestClient_Do_reportBytes(t *testing.T) {
+	a := assert.New(t)
+	lb := &recordBalancer{}
+	c := New(lb, &memoryRegistry{nodes: newTestNodes()})
+
+	// fn 报告的字节数随调用结果反馈给负载均衡器
+	err := c.Do(context.Background(), "test", func(ctx context.Context, _ *discovery.ServiceNode) error {
+		ReportBytes(ctx, 10, 20)
+		ReportBytes(ctx, 1, 2)
+		return nil
+	})
+	a.Nil(err)
+	a.Len(lb.infos, 1)
+	a.Equal(int64(11), lb.infos[0].BytesSent)
+	a.Equal(int64(22), lb.infos[0].BytesReceived)
+}
+
+func TestClient_Do_retryBudget(t *testing.T) {
+	a := assert.New(t)
+	c := New(loadbalancer.NewRoundRobin(), &memoryRegistry{nodes: newTestNodes()}, WithRetryBudget(RetryBudgetConfig{Ratio: 0.5, MaxTokens: 2}))
+	ctx := context.Background()
+	calls := 0
+	fn := func(context.Context, *discovery.ServiceNode) error {
+		calls++
+		return errTest
+	}
+
+	// 令牌桶初始是满的，允许少量突发重试
+	a.ErrorIs(c.Do(ctx, "test", fn, WithBackoff(0, 0), WithMaxAttempts(10)), errTest)
+	a.Equal(3, calls)
+
+	// 预算耗尽后每两个请求才能重试一次
+	calls = 0
+	for i := 0; i < 4; i++ {
+		_ = c.Do(ctx, "test", fn, WithBackoff(0, 0))
+	}
+	a.Equal(6, calls)
+}
+
+func TestClient_Do_singleNode(t *testing.T) {
+	a := assert.New(t)
+	c := New(loadbalancer.NewRoundRobin(), &memoryRegistry{nodes: newTestNodes()[:1]}, WithRetryBudget(RetryBudgetConfig{Ratio: 0.5, MaxTokens: 3}))
+	ctx := context.Background()
+
+	// 没有其他节点可以重试时不消耗重试预算
+	for i := 0; i < 3; i++ {
+		calls := 0
+		err := c.Do(ctx, "test", func(context.Context, *discovery.ServiceNode) error {
+			calls++
+			return errTest
+		}, WithBackoff(time.Hour, time.Hour))
+		a.ErrorIs(err, errTest)
+		a.Equal(1, calls)
+	}
+	a.Equal(float64(3), c.budget("test").tokens)
+}
@@ -2,6 +2,7 @@ package consul
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	capi "github.com/hashicorp/consul/api"
 	"github.com/hashicorp/consul/api/watch"
@@ -13,27 +14,25 @@ import (
 
 type registry struct {
 	nodeListMap *sync.Map // <serviceName, <nodeKey, *ServiceNode>>
+	services    *sync.Map // <nodeKey, struct{}> 本实例注册的服务
+	plans       *sync.Map // <serviceName, *watch.Plan>
+	broadcaster *discovery.Broadcaster
 	config      *capi.Config
 	client      *capi.Client
+
+	mu     sync.Mutex
+	closed bool
+	wg     sync.WaitGroup
 }
 
 func (r *registry) GetNodes(ctx context.Context, serviceName string, tags map[string]string) ([]*discovery.ServiceNode, error) {
-	nodes, exists := r.nodeListMap.Load(serviceName)
-	if !exists {
-		var err error
-		// 本地缓存为空，从 consul 拉取
-		nodes, err = r.pullNodes(ctx, serviceName)
-		if err != nil {
-			return nil, err
-		}
-		// 缓存到本地
-		r.nodeListMap.Store(serviceName, nodes)
-		// 启动watch
-		go r.watchNodes(serviceName)
+	nodes, err := r.loadNodes(ctx, serviceName)
+	if err != nil {
+		return nil, err
 	}
 	// 按标签过滤节点
 	var filteredNodes []*discovery.ServiceNode
-	nodes.(*sync.Map).Range(func(key, value interface{}) bool {
+	nodes.Range(func(key, value interface{}) bool {
 		node := value.(*discovery.ServiceNode)
 		if discovery.MatchTags(node.Tags, tags) {
 			filteredNodes = append(filteredNodes, node)
@@ -43,6 +42,39 @@ func (r *registry) GetNodes(ctx context.Context, serviceName string, tags map[st
 	return filteredNodes, nil
 }
 
+func (r *registry) Watch(ctx context.Context, serviceName string, tags map[string]string) (<-chan *discovery.Event, error) {
+	nodes, err := r.loadNodes(ctx, serviceName)
+	if err != nil {
+		return nil, err
+	}
+	return r.broadcaster.Subscribe(ctx, serviceName, tags, nodes), nil
+}
+
+// loadNodes 读取本地缓存的服务节点，缓存为空时从 consul 拉取并启动watch
+func (r *registry) loadNodes(ctx context.Context, serviceName string) (*sync.Map, error) {
+	if nodes, exists := r.nodeListMap.Load(serviceName); exists {
+		return nodes.(*sync.Map), nil
+	}
+	if r.isClosed() {
+		return nil, discovery.ErrRegistryClosed
+	}
+	// 本地缓存为空，从 consul 拉取
+	nodes, err := r.pullNodes(ctx, serviceName)
+	if err != nil {
+		return nil, err
+	}
+	// 缓存到本地
+	actual, loaded := r.nodeListMap.LoadOrStore(serviceName, nodes)
+	if !loaded {
+		// 启动watch
+		if !r.spawn(func() { r.watchNodes(serviceName) }) {
+			r.nodeListMap.Delete(serviceName)
+			return nil, discovery.ErrRegistryClosed
+		}
+	}
+	return actual.(*sync.Map), nil
+}
+
 func (r *registry) Register(ctx context.Context, node *discovery.ServiceNode) error {
 	service := &capi.AgentServiceRegistration{
 		ID:      makeNodeKey(node),
@@ -62,6 +94,7 @@ func (r *registry) Register(ctx context.Context, node *discovery.ServiceNode) er
 	if err != nil {
 		return fmt.Errorf("register service error: %w", err)
 	}
+	r.services.Store(service.ID, struct{}{})
 	return nil
 }
 
@@ -72,9 +105,54 @@ func (r *registry) Unregister(ctx context.Context, node *discovery.ServiceNode)
 	if err != nil {
 		return fmt.Errorf("unregister service error: %w", err)
 	}
+	r.services.Delete(makeNodeKey(node))
 	return nil
 }
 
+func (r *registry) Close() error {
+	r.mu.Lock()
+	if r.closed {
+		r.mu.Unlock()
+		return nil
+	}
+	r.closed = true
+	r.mu.Unlock()
+
+	// 停止watch
+	r.plans.Range(func(key, value interface{}) bool {
+		value.(*watch.Plan).Stop()
+		return true
+	})
+	r.wg.Wait()
+	r.broadcaster.Close()
+
+	// 注销本实例注册的服务，与 etcd 租约、zookeeper 临时节点的行为保持一致
+	var errs []error
+	r.services.Range(func(key, value interface{}) bool {
+		if err := r.client.Agent().ServiceDeregister(key.(string)); err != nil {
+			errs = append(errs, fmt.Errorf("unregister service %v error: %w", key, err))
+		}
+		r.services.Delete(key)
+		return true
+	})
+	return errors.Join(errs...)
+}
+
+// spawn 在注册中心未关闭时启动后台协程，Close 会等待其退出
+func (r *registry) spawn(f func()) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.closed {
+		return false
+	}
+	r.wg.Add(1)
+	go func() {
+		defer r.wg.Done()
+		f()
+	}()
+	return true
+}
+
 func (r *registry) pullNodes(ctx context.Context, name string) (*sync.Map, error) {
 	opts := &capi.QueryOptions{}
 	opts = opts.WithContext(ctx)
@@ -110,7 +188,9 @@ func (r *registry) watchNodes(name string) {
 			return
 		}
 		if len(val) == 0 {
-			r.nodeListMap.Store(name, &sync.Map{})
+			empty := &sync.Map{}
+			r.nodeListMap.Store(name, empty)
+			r.broadcaster.Publish(name, empty)
 			return
 		}
 		var (
@@ -131,13 +211,25 @@ func (r *registry) watchNodes(name string) {
 			}
 		}
 		r.nodeListMap.Store(name, &healthInstances)
+		r.broadcaster.Publish(name, &healthInstances)
 	}
 	defer plan.Stop()
+	r.plans.Store(name, plan)
+	defer r.plans.Delete(name)
+	if r.isClosed() {
+		return
+	}
 	if err := plan.Run(r.config.Address); err != nil {
 		log.Printf("watch service %s error: %v", name, err)
 	}
 }
 
+func (r *registry) isClosed() bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.closed
+}
+
 func NewRegistry(config *capi.Config) (discovery.NodeRegistry, error) {
 	client, err := capi.NewClient(config)
 	if err != nil {
@@ -145,6 +237,9 @@ func NewRegistry(config *capi.Config) (discovery.NodeRegistry, error) {
 	}
 	return &registry{
 		nodeListMap: new(sync.Map),
+		services:    new(sync.Map),
+		plans:       new(sync.Map),
+		broadcaster: discovery.NewBroadcaster(),
 		client:      client,
 		config:      config,
 	}, nil
@@ -110,4 +110,46 @@ func TestEtcdRegistry(t *testing.T) {
 		a.Nil(err)
 		a.Len(nodes, 0)
 	})
+	t.Run("Watch nodes", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		events, err := r.Watch(ctx, "test", map[string]string{
+			"version": "1.0",
+		})
+		a.Nil(err)
+		// 首个事件为全量节点
+		event := <-events
+		a.Equal(discovery.EventSync, event.Type)
+		a.Len(event.Nodes, 0)
+
+		node := &discovery.ServiceNode{
+			ServiceName: "test",
+			IP:          net.IPv4(127, 0, 0, 1),
+			Port:        8484,
+			Tags: map[string]string{
+				"version": "1.0",
+			},
+		}
+		// 注册节点
+		err = r.Register(context.Background(), node)
+		a.Nil(err)
+		event = <-events
+		a.Equal(discovery.EventAdd, event.Type)
+		a.Equal(node, event.Node)
+		a.Len(event.Nodes, 1)
+		// 注销节点
+		err = r.Unregister(context.Background(), node)
+		a.Nil(err)
+		event = <-events
+		a.Equal(discovery.EventDelete, event.Type)
+		a.Len(event.Nodes, 0)
+	})
+	t.Run("Close registry", func(t *testing.T) {
+		a.Nil(r.Close())
+		// 关闭后无法再拉取新的服务
+		_, err := r.GetNodes(context.Background(), "closed", nil)
+		a.ErrorIs(err, discovery.ErrRegistryClosed)
+		// 重复关闭
+		a.Nil(r.Close())
+	})
 }
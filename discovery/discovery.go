@@ -2,9 +2,15 @@ package discovery
 
 import (
 	"context"
+	"errors"
+	"io"
 	"net"
+	"strconv"
 )
 
+// ErrRegistryClosed 注册中心已关闭
+var ErrRegistryClosed = errors.New("registry closed")
+
 // ServiceNode 服务节点
 type ServiceNode struct {
 	ServiceName string
@@ -13,14 +19,23 @@ type ServiceNode struct {
 	Tags        map[string]string
 }
 
+// Address 节点地址 ip:port
+func (n *ServiceNode) Address() string {
+	return net.JoinHostPort(n.IP.String(), strconv.Itoa(n.Port))
+}
+
 // NodeRegistry 服务节点注册中心
 type NodeRegistry interface {
 	// GetNodes 获取服务节点
 	GetNodes(ctx context.Context, serviceName string, tags map[string]string) ([]*ServiceNode, error)
+	// Watch 监听服务节点变化，首个事件为全量节点，ctx 结束时 channel 被关闭
+	Watch(ctx context.Context, serviceName string, tags map[string]string) (<-chan *Event, error)
 	// Register 注册服务节点
 	Register(ctx context.Context, node *ServiceNode) error
 	// Unregister 注销服务节点
 	Unregister(ctx context.Context, node *ServiceNode) error
+	// Close 停止所有监听和续租协程，释放与注册中心的连接
+	io.Closer
 }
 
 // MatchTags 匹配标签
@@ -0,0 +1,64 @@
+package etcd
+
+import (
+	"crypto/tls"
+	"go.etcd.io/etcd/client/v3"
+	"strings"
+	"time"
+)
+
+// Option 注册中心选项
+type Option func(o *options)
+
+type options struct {
+	prefix      string
+	username    string
+	password    string
+	tls         *tls.Config
+	leaseTTL    time.Duration
+	dialTimeout time.Duration
+	client      *clientv3.Client
+}
+
+// WithPrefix 节点 key 的根路径，如 /services/prod，节点 key 为 <prefix>/<serviceName>/<ip:port>
+func WithPrefix(prefix string) Option {
+	return func(o *options) {
+		o.prefix = strings.TrimSuffix(prefix, "/")
+	}
+}
+
+// WithAuth 使用用户名和密码认证
+func WithAuth(username, password string) Option {
+	return func(o *options) {
+		o.username = username
+		o.password = password
+	}
+}
+
+// WithTLS 使用 TLS 连接 etcd
+func WithTLS(config *tls.Config) Option {
+	return func(o *options) {
+		o.tls = config
+	}
+}
+
+// WithLeaseTTL 租约时间，etcd 租约以秒为单位，不足一秒的部分向上取整，小于等于 0 时使用 LeaseTTL
+func WithLeaseTTL(ttl time.Duration) Option {
+	return func(o *options) {
+		o.leaseTTL = ttl
+	}
+}
+
+// WithDialTimeout 连接和请求的超时时间，小于等于 0 时使用 DialTimeout
+func WithDialTimeout(timeout time.Duration) Option {
+	return func(o *options) {
+		o.dialTimeout = timeout
+	}
+}
+
+// WithClient 使用已有的 etcd 客户端，此时忽略 endpoints 和连接相关的选项，Close 时不会关闭该客户端
+func WithClient(client *clientv3.Client) Option {
+	return func(o *options) {
+		o.client = client
+	}
+}
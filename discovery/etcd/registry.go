@@ -2,9 +2,11 @@ package etcd
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	json "github.com/json-iterator/go"
 	"github.com/xialeistudio/go-service-discovery/discovery"
+	"go.etcd.io/etcd/api/v3/v3rpc/rpctypes"
 	"go.etcd.io/etcd/client/v3"
 	"log"
 	"strconv"
@@ -13,57 +15,131 @@ import (
 )
 
 var (
-	// DialTimeout 默认的连接超时时间
+	// DialTimeout 默认的连接超时时间，可以通过 WithDialTimeout 为每个注册中心单独设置
 	DialTimeout = 5 * time.Second
-	// LeaseTTL 默认的租约时间
+	// LeaseTTL 默认的租约时间，可以通过 WithLeaseTTL 为每个注册中心单独设置
 	LeaseTTL = 10 * time.Second
 )
 
+// RegistrationEventType 注册状态事件类型
+type RegistrationEventType int
+
+const (
+	// RegistrationLost 租约过期，本实例注册的节点已从 etcd 中删除
+	RegistrationLost RegistrationEventType = iota
+	// RegistrationRestored 重新创建租约并写回了本实例注册的所有节点
+	RegistrationRestored
+)
+
+// String 事件类型名称
+func (t RegistrationEventType) String() string {
+	switch t {
+	case RegistrationLost:
+		return "lost"
+	case RegistrationRestored:
+		return "restored"
+	}
+	return "unknown"
+}
+
+// RegistrationEvent 注册状态事件
+type RegistrationEvent struct {
+	Type RegistrationEventType
+	// Err 租约续期失败的原因，可能为 nil
+	Err error
+}
+
+// Registry etcd 注册中心
+type Registry interface {
+	discovery.NodeRegistry
+	// Events 注册状态变化事件，消费不及时时丢弃新事件，Close 时 channel 被关闭
+	Events() <-chan RegistrationEvent
+}
+
 type registry struct {
 	nodeListMap *sync.Map // <serviceName, <nodeKey, *ServiceNode>>
+	broadcaster *discovery.Broadcaster
+	events      chan RegistrationEvent
+
+	leaseMu sync.Mutex
+	lease   clientv3.LeaseID  // 本实例注册的所有节点共享的租约，0 表示尚未创建或已过期
+	owned   map[string]string // <nodeKey, 节点 JSON>，租约过期后用于重新注册
+	// stopKeepAlive 停止续租协程，lease 为 0 而 stopKeepAlive 不为 nil 时续租协程正在重新注册
+	stopKeepAlive context.CancelFunc
+
+	options    options
+	client     *clientv3.Client
+	ownsClient bool // 客户端由注册中心创建，Close 时关闭
+	watcher    clientv3.Watcher
+	kv         clientv3.KV
 
-	client  *clientv3.Client
-	watcher clientv3.Watcher
-	kv      clientv3.KV
+	mu     sync.Mutex
+	closed bool
+	ctx    context.Context // 后台协程的生命周期，Close 时取消
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
 }
 
-func NewRegistry(endpoints []string) (discovery.NodeRegistry, error) {
-	config := clientv3.Config{
-		Endpoints:   endpoints,
-		DialTimeout: DialTimeout,
+// NewRegistry 创建 etcd 注册中心，使用 WithClient 时 endpoints 可以为空
+func NewRegistry(endpoints []string, opts ...Option) (Registry, error) {
+	o := options{
+		leaseTTL:    LeaseTTL,
+		dialTimeout: DialTimeout,
 	}
-	client, err := clientv3.New(config)
-	if err != nil {
-		return nil, fmt.Errorf("failed to create etcd client: %v", err)
+	for _, opt := range opts {
+		opt(&o)
+	}
+	if o.leaseTTL <= 0 {
+		o.leaseTTL = LeaseTTL
+	}
+	if remainder := o.leaseTTL % time.Second; remainder != 0 {
+		o.leaseTTL += time.Second - remainder
+	}
+	if o.dialTimeout <= 0 {
+		o.dialTimeout = DialTimeout
 	}
+
+	client, ownsClient := o.client, false
+	if client == nil {
+		config := clientv3.Config{
+			Endpoints:   endpoints,
+			DialTimeout: o.dialTimeout,
+			Username:    o.username,
+			Password:    o.password,
+			TLS:         o.tls,
+		}
+		var err error
+		client, err = clientv3.New(config)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create etcd client: %v", err)
+		}
+		ownsClient = true
+	}
+	ctx, cancel := context.WithCancel(context.Background())
 	return &registry{
 		nodeListMap: &sync.Map{},
+		broadcaster: discovery.NewBroadcaster(),
+		events:      make(chan RegistrationEvent, 16),
+		owned:       make(map[string]string),
+		options:     o,
 		client:      client,
+		ownsClient:  ownsClient,
 		kv:          clientv3.NewKV(client),
 		watcher:     clientv3.NewWatcher(client),
+		ctx:         ctx,
+		cancel:      cancel,
 	}, nil
 }
 
 func (r *registry) GetNodes(ctx context.Context, serviceName string, tags map[string]string) ([]*discovery.ServiceNode, error) {
-	// 检查本地缓存是否有服务节点
-
-	nodes, exists := r.nodeListMap.Load(serviceName)
-	if !exists {
-		var err error
-		// 本地缓存为空，从 etcd 拉取
-		nodes, err = r.pullNodes(ctx, serviceName)
-		if err != nil {
-			return nil, err
-		}
-		// 缓存到本地
-		r.nodeListMap.Store(serviceName, nodes)
-		// 启动协程监听节点变化
-		go r.watchNodes(ctx, serviceName)
+	nodes, err := r.loadNodes(ctx, serviceName)
+	if err != nil {
+		return nil, err
 	}
 
 	// 根据标签过滤服务节点
 	var filteredNodes []*discovery.ServiceNode
-	nodes.(*sync.Map).Range(func(key, value interface{}) bool {
+	nodes.Range(func(key, value interface{}) bool {
 		node := value.(*discovery.ServiceNode)
 		if discovery.MatchTags(node.Tags, tags) {
 			filteredNodes = append(filteredNodes, node)
@@ -74,85 +150,346 @@ func (r *registry) GetNodes(ctx context.Context, serviceName string, tags map[st
 	return filteredNodes, nil
 }
 
+func (r *registry) Watch(ctx context.Context, serviceName string, tags map[string]string) (<-chan *discovery.Event, error) {
+	nodes, err := r.loadNodes(ctx, serviceName)
+	if err != nil {
+		return nil, err
+	}
+	return r.broadcaster.Subscribe(ctx, serviceName, tags, nodes), nil
+}
+
+// loadNodes 读取本地缓存的服务节点，缓存为空时从 etcd 拉取并启动监听
+func (r *registry) loadNodes(ctx context.Context, serviceName string) (*sync.Map, error) {
+	// 检查本地缓存是否有服务节点
+	if nodes, exists := r.nodeListMap.Load(serviceName); exists {
+		return nodes.(*sync.Map), nil
+	}
+	if r.ctx.Err() != nil {
+		return nil, discovery.ErrRegistryClosed
+	}
+	// 本地缓存为空，从 etcd 拉取
+	nodes, revision, err := r.pullNodes(ctx, serviceName)
+	if err != nil {
+		return nil, err
+	}
+	// 缓存到本地
+	actual, loaded := r.nodeListMap.LoadOrStore(serviceName, nodes)
+	if !loaded {
+		// 启动协程从拉取时的版本开始监听节点变化
+		if !r.spawn(func() { r.watchNodes(serviceName, revision) }) {
+			r.nodeListMap.Delete(serviceName)
+			return nil, discovery.ErrRegistryClosed
+		}
+	}
+	return actual.(*sync.Map), nil
+}
+
 func (r *registry) Register(ctx context.Context, node *discovery.ServiceNode) error {
 	value, err := json.MarshalToString(node)
 	if err != nil {
 		return fmt.Errorf("failed to marshal service node: %v", err)
 	}
-	// 创建租约
-	lease, err := r.client.Grant(ctx, int64(LeaseTTL.Seconds()))
+
+	r.leaseMu.Lock()
+	defer r.leaseMu.Unlock()
+	lease, err := r.sharedLease(ctx)
 	if err != nil {
 		return err
 	}
 	// 将服务节点信息写入etcd
-	key := makeNodeKey(node)
-	_, err = r.kv.Put(ctx, key, value, clientv3.WithLease(lease.ID))
+	key := r.nodeKey(node)
+	_, err = r.kv.Put(ctx, key, value, clientv3.WithLease(lease))
 	if err != nil {
 		return fmt.Errorf("failed to put key to etcd: %v", err)
 	}
-
-	// 续租
-	go r.keepLeaseAlive(lease.ID, node)
+	r.owned[key] = value
 	return nil
 }
 
 func (r *registry) Unregister(ctx context.Context, node *discovery.ServiceNode) error {
-	key := makeNodeKey(node)
+	key := r.nodeKey(node)
+	r.leaseMu.Lock()
+	defer r.leaseMu.Unlock()
+	delete(r.owned, key)
+
 	_, err := r.kv.Delete(ctx, key)
 	if err != nil {
 		return fmt.Errorf("failed to delete key from etcd: %v", err)
 	}
 	r.removeNode(node)
+
+	// 没有节点使用租约时停止续租并撤销租约，下次注册时重新创建
+	if len(r.owned) == 0 && r.stopKeepAlive != nil {
+		r.stopKeepAlive()
+		lease := r.lease
+		r.lease, r.stopKeepAlive = 0, nil
+		if lease != 0 {
+			return r.revoke(ctx, lease)
+		}
+	}
 	return nil
 }
 
-func makeNodeKey(node *discovery.ServiceNode) string {
-	return node.ServiceName + "/" + node.IP.String() + ":" + strconv.Itoa(node.Port)
+// revoke 撤销租约，租约已过期时视为成功
+func (r *registry) revoke(ctx context.Context, lease clientv3.LeaseID) error {
+	if _, err := r.client.Revoke(ctx, lease); err != nil && !errors.Is(err, rpctypes.ErrLeaseNotFound) {
+		return fmt.Errorf("failed to revoke lease: %v", err)
+	}
+	return nil
 }
 
-// 续租
-func (r *registry) keepLeaseAlive(leaseId clientv3.LeaseID, node *discovery.ServiceNode) {
-	ticker := time.NewTicker(LeaseTTL / 2)
-	defer ticker.Stop()
-	for range ticker.C {
-		func() {
-			_, err := r.client.KeepAliveOnce(context.Background(), leaseId)
-			if err != nil {
-				r.removeNode(node)
-				return
+func (r *registry) Events() <-chan RegistrationEvent {
+	return r.events
+}
+
+func (r *registry) Close() error {
+	r.mu.Lock()
+	if r.closed {
+		r.mu.Unlock()
+		return nil
+	}
+	r.closed = true
+	r.mu.Unlock()
+
+	// 停止监听和续租协程
+	r.cancel()
+	r.wg.Wait()
+	r.broadcaster.Close()
+	close(r.events)
+
+	// 撤销租约，立即删除本实例注册的节点
+	var errs []error
+	r.leaseMu.Lock()
+	if r.lease != 0 {
+		ctx, cancel := context.WithTimeout(context.Background(), r.options.dialTimeout)
+		if err := r.revoke(ctx, r.lease); err != nil {
+			errs = append(errs, err)
+		}
+		cancel()
+		r.lease = 0
+	}
+	r.leaseMu.Unlock()
+	if err := r.watcher.Close(); err != nil {
+		errs = append(errs, fmt.Errorf("failed to close etcd watcher: %v", err))
+	}
+	if r.ownsClient {
+		if err := r.client.Close(); err != nil {
+			errs = append(errs, fmt.Errorf("failed to close etcd client: %v", err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// spawn 在注册中心未关闭时启动后台协程，Close 会等待其退出
+func (r *registry) spawn(f func()) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.closed {
+		return false
+	}
+	r.wg.Add(1)
+	go func() {
+		defer r.wg.Done()
+		f()
+	}()
+	return true
+}
+
+// servicePrefix 服务节点 key 的前缀
+func (r *registry) servicePrefix(serviceName string) string {
+	if r.options.prefix == "" {
+		return serviceName + "/"
+	}
+	return r.options.prefix + "/" + serviceName + "/"
+}
+
+func (r *registry) nodeKey(node *discovery.ServiceNode) string {
+	return r.servicePrefix(node.ServiceName) + node.IP.String() + ":" + strconv.Itoa(node.Port)
+}
+
+// sharedLease 返回共享租约，首次注册时创建租约并启动续租协程，调用方需持有 leaseMu
+func (r *registry) sharedLease(ctx context.Context) (clientv3.LeaseID, error) {
+	if r.lease != 0 {
+		return r.lease, nil
+	}
+	if r.ctx.Err() != nil {
+		return 0, discovery.ErrRegistryClosed
+	}
+	if r.stopKeepAlive != nil {
+		// 租约已过期，不等待续租协程，直接重新注册，续租协程会接管新的租约
+		return r.grantAndPut(ctx)
+	}
+	lease, err := r.client.Grant(ctx, int64(r.options.leaseTTL.Seconds()))
+	if err != nil {
+		return 0, fmt.Errorf("failed to grant lease: %v", err)
+	}
+	keepAliveCtx, stop := context.WithCancel(r.ctx)
+	if !r.spawn(func() { r.keepAlive(keepAliveCtx, lease.ID) }) {
+		// 注册期间注册中心被关闭，撤销刚创建的租约
+		stop()
+		_, _ = r.client.Revoke(ctx, lease.ID)
+		return 0, discovery.ErrRegistryClosed
+	}
+	r.lease, r.stopKeepAlive = lease.ID, stop
+	return r.lease, nil
+}
+
+// keepAlive 续租，租约过期后重新创建租约并写回本实例注册的节点，ctx 结束时退出
+func (r *registry) keepAlive(ctx context.Context, lease clientv3.LeaseID) {
+	for {
+		// 网络断开时 KeepAlive 会自动重试，租约过期或被撤销时关闭 channel
+		ch, err := r.client.KeepAlive(ctx, lease)
+		if err == nil {
+			for range ch {
 			}
-		}()
+		}
+		if !r.leaseLost(ctx, lease) {
+			return
+		}
+		r.emit(RegistrationEvent{Type: RegistrationLost, Err: err})
+		if lease = r.restore(ctx); lease == 0 {
+			return
+		}
+		r.emit(RegistrationEvent{Type: RegistrationRestored})
+	}
+}
+
+// leaseLost 清除已过期的租约，避免 Register 继续使用，续租已被停止时返回 false
+func (r *registry) leaseLost(ctx context.Context, lease clientv3.LeaseID) bool {
+	r.leaseMu.Lock()
+	defer r.leaseMu.Unlock()
+	if ctx.Err() != nil {
+		return false
+	}
+	if r.lease == lease {
+		r.lease = 0
+	}
+	return true
+}
+
+// restore 重新注册直到成功，ctx 结束时返回 0
+func (r *registry) restore(ctx context.Context) clientv3.LeaseID {
+	for {
+		lease, err := r.reRegister(ctx)
+		if err == nil {
+			return lease
+		}
+		if ctx.Err() != nil {
+			return 0
+		}
+		log.Printf("failed to restore registration: %v", err)
+		select {
+		case <-ctx.Done():
+			return 0
+		case <-time.After(time.Second):
+		}
+	}
+}
+
+func (r *registry) reRegister(ctx context.Context) (clientv3.LeaseID, error) {
+	r.leaseMu.Lock()
+	defer r.leaseMu.Unlock()
+	// 等待锁期间续租可能已被 Unregister 停止
+	if ctx.Err() != nil {
+		return 0, ctx.Err()
+	}
+	if r.lease != 0 {
+		// Register 已经在新租约上重新注册
+		return r.lease, nil
+	}
+	ctx, cancel := context.WithTimeout(ctx, r.options.dialTimeout)
+	defer cancel()
+	return r.grantAndPut(ctx)
+}
+
+// grantAndPut 创建新租约并写回本实例注册的所有节点，调用方需持有 leaseMu
+func (r *registry) grantAndPut(ctx context.Context) (clientv3.LeaseID, error) {
+	lease, err := r.client.Grant(ctx, int64(r.options.leaseTTL.Seconds()))
+	if err != nil {
+		return 0, fmt.Errorf("failed to grant lease: %v", err)
+	}
+	for key, value := range r.owned {
+		if _, err := r.kv.Put(ctx, key, value, clientv3.WithLease(lease.ID)); err != nil {
+			_, _ = r.client.Revoke(ctx, lease.ID)
+			return 0, fmt.Errorf("failed to put key to etcd: %v", err)
+		}
+	}
+	r.lease = lease.ID
+	return r.lease, nil
+}
+
+// emit 发送注册状态事件，调用方消费不及时时丢弃
+func (r *registry) emit(event RegistrationEvent) {
+	select {
+	case r.events <- event:
+	default:
 	}
 }
 
 func (r *registry) removeNode(node *discovery.ServiceNode) {
 	r.nodeListMap.Range(func(key, value interface{}) bool {
 		nodes := value.(*sync.Map)
-		nodes.Delete(makeNodeKey(node))
+		if _, loaded := nodes.LoadAndDelete(r.nodeKey(node)); loaded {
+			r.broadcaster.Publish(key.(string), nodes)
+		}
 		return true
 	})
 }
 
-func (r *registry) pullNodes(ctx context.Context, serviceName string) (*sync.Map, error) {
-	resp, err := r.kv.Get(ctx, serviceName+"/", clientv3.WithPrefix())
+// pullNodes 拉取服务的全部节点，同时返回拉取时的版本号
+func (r *registry) pullNodes(ctx context.Context, serviceName string) (*sync.Map, int64, error) {
+	resp, err := r.kv.Get(ctx, r.servicePrefix(serviceName), clientv3.WithPrefix())
 	if err != nil {
-		return nil, fmt.Errorf("failed to get nodeListMap from etcd: %v", err)
+		return nil, 0, fmt.Errorf("failed to get nodeListMap from etcd: %v", err)
 	}
 	var nodes sync.Map
 	for _, kv := range resp.Kvs {
 		node := &discovery.ServiceNode{}
 		if err := json.Unmarshal(kv.Value, node); err != nil {
-			return nil, fmt.Errorf("failed to unmarshal node data: %v", err)
+			return nil, 0, fmt.Errorf("failed to unmarshal node data: %v", err)
 		}
 		nodes.Store(string(kv.Key), node)
 	}
 
-	return &nodes, nil
+	return &nodes, resp.Header.Revision, nil
 }
 
-func (r *registry) watchNodes(ctx context.Context, serviceName string) {
-	watchChan := r.watcher.Watch(ctx, serviceName+"/", clientv3.WithPrefix())
+// watchNodes 从 revision 之后开始监听节点变化，监听因版本被压缩或连接断开而结束时全量同步后重新监听
+func (r *registry) watchNodes(serviceName string, revision int64) {
+	for {
+		r.watchFrom(serviceName, revision)
+		for {
+			if r.ctx.Err() != nil {
+				return
+			}
+			var err error
+			if revision, err = r.resync(serviceName); err == nil {
+				break
+			}
+			log.Printf("failed to resync service %s: %v", serviceName, err)
+			select {
+			case <-r.ctx.Done():
+				return
+			case <-time.After(time.Second):
+			}
+		}
+	}
+}
+
+// watchFrom 监听 revision 之后的节点变化，直到监听出错或结束
+func (r *registry) watchFrom(serviceName string, revision int64) {
+	// 与 leader 失联时结束监听，避免在网络分区期间使用过期的数据
+	ctx := clientv3.WithRequireLeader(r.ctx)
+	watchChan := r.watcher.Watch(ctx, r.servicePrefix(serviceName), clientv3.WithPrefix(), clientv3.WithRev(revision+1))
 	for wResp := range watchChan {
+		if err := wResp.Err(); err != nil {
+			if r.ctx.Err() == nil {
+				log.Printf("failed to watch service %s: %v", serviceName, err)
+			}
+			return
+		}
+		value, _ := r.nodeListMap.Load(serviceName)
+		nodes := value.(*sync.Map)
 		for _, ev := range wResp.Events {
 			switch ev.Type {
 			case clientv3.EventTypePut:
@@ -162,14 +499,36 @@ func (r *registry) watchNodes(ctx context.Context, serviceName string) {
 					log.Printf("failed to unmarshal node data: %v", err)
 					continue
 				}
-				r.nodeListMap.LoadOrStore(serviceName, &sync.Map{})
-				nodes, _ := r.nodeListMap.Load(serviceName)
-				nodes.(*sync.Map).Store(string(ev.Kv.Key), node)
+				nodes.Store(string(ev.Kv.Key), node)
 			case clientv3.EventTypeDelete:
 				// 删除服务节点
-				nodes, _ := r.nodeListMap.Load(serviceName)
-				nodes.(*sync.Map).Delete(string(ev.Kv.Key))
+				nodes.Delete(string(ev.Kv.Key))
 			}
 		}
+		r.broadcaster.Publish(serviceName, nodes)
 	}
 }
+
+// resync 全量拉取节点替换本地缓存，返回拉取时的版本号
+func (r *registry) resync(serviceName string) (int64, error) {
+	ctx, cancel := context.WithTimeout(r.ctx, r.options.dialTimeout)
+	defer cancel()
+	latest, revision, err := r.pullNodes(ctx, serviceName)
+	if err != nil {
+		return 0, err
+	}
+	value, _ := r.nodeListMap.Load(serviceName)
+	nodes := value.(*sync.Map)
+	nodes.Range(func(key, _ interface{}) bool {
+		if _, exists := latest.Load(key); !exists {
+			nodes.Delete(key)
+		}
+		return true
+	})
+	latest.Range(func(key, node interface{}) bool {
+		nodes.Store(key, node)
+		return true
+	})
+	r.broadcaster.Publish(serviceName, nodes)
+	return revision, nil
+}
@@ -5,7 +5,9 @@ import (
 	json "github.com/json-iterator/go"
 	"github.com/stretchr/testify/assert"
 	"github.com/xialeistudio/go-service-discovery/discovery"
+	"go.etcd.io/etcd/client/v3"
 	"net"
+	"sync"
 	"testing"
 	"time"
 )
@@ -107,4 +109,219 @@ func TestEtcdRegistry(t *testing.T) {
 		a.Nil(err)
 		a.Len(nodes, 0)
 	})
+	t.Run("Watch nodes", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		events, err := r.Watch(ctx, "test", map[string]string{
+			"version": "1.0",
+		})
+		a.Nil(err)
+		// 首个事件为全量节点
+		event := <-events
+		a.Equal(discovery.EventSync, event.Type)
+		a.Len(event.Nodes, 0)
+
+		node := &discovery.ServiceNode{
+			ServiceName: "test",
+			IP:          net.IPv4(127, 0, 0, 1),
+			Port:        8484,
+			Tags: map[string]string{
+				"version": "1.0",
+			},
+		}
+		// 注册节点
+		err = r.Register(context.Background(), node)
+		a.Nil(err)
+		event = <-events
+		a.Equal(discovery.EventAdd, event.Type)
+		a.Equal(node, event.Node)
+		a.Len(event.Nodes, 1)
+		// 注销节点
+		err = r.Unregister(context.Background(), node)
+		a.Nil(err)
+		event = <-events
+		a.Equal(discovery.EventDelete, event.Type)
+		a.Len(event.Nodes, 0)
+	})
+	t.Run("Restore registration", func(t *testing.T) {
+		node := &discovery.ServiceNode{
+			ServiceName: "test",
+			IP:          net.IPv4(127, 0, 0, 1),
+			Port:        8484,
+			Tags: map[string]string{
+				"version": "1.0",
+			},
+		}
+		err = r.Register(context.Background(), node)
+		a.Nil(err)
+		// 模拟租约过期
+		reg := r.(*registry)
+		reg.leaseMu.Lock()
+		lease := reg.lease
+		reg.leaseMu.Unlock()
+		_, err = reg.client.Revoke(context.Background(), lease)
+		a.Nil(err)
+		// 租约过期后自动重新注册
+		a.Equal(RegistrationLost, (<-r.Events()).Type)
+		a.Equal(RegistrationRestored, (<-r.Events()).Type)
+		time.Sleep(time.Millisecond * 100)
+		nodes, err := r.GetNodes(context.Background(), "test", nil)
+		a.Nil(err)
+		a.Equal([]*discovery.ServiceNode{node}, nodes)
+		err = r.Unregister(context.Background(), node)
+		a.Nil(err)
+	})
+	t.Run("Register after lease lost", func(t *testing.T) {
+		node1 := &discovery.ServiceNode{
+			ServiceName: "test",
+			IP:          net.IPv4(127, 0, 0, 1),
+			Port:        8484,
+		}
+		node2 := &discovery.ServiceNode{
+			ServiceName: "test",
+			IP:          net.IPv4(127, 0, 0, 2),
+			Port:        8484,
+		}
+		a.Nil(r.Register(context.Background(), node1))
+		reg := r.(*registry)
+		reg.leaseMu.Lock()
+		lease := reg.lease
+		reg.leaseMu.Unlock()
+		_, err = reg.client.Revoke(context.Background(), lease)
+		a.Nil(err)
+		a.Equal(RegistrationLost, (<-r.Events()).Type)
+
+		// 租约过期后注册不会使用已过期的租约
+		a.Nil(r.Register(context.Background(), node2))
+		a.Equal(RegistrationRestored, (<-r.Events()).Type)
+		time.Sleep(time.Millisecond * 100)
+		nodes, err := r.GetNodes(context.Background(), "test", nil)
+		a.Nil(err)
+		a.ElementsMatch([]*discovery.ServiceNode{node1, node2}, nodes)
+
+		// 租约已过期时注销视为成功
+		reg.leaseMu.Lock()
+		lease = reg.lease
+		reg.leaseMu.Unlock()
+		_, err = reg.client.Revoke(context.Background(), lease)
+		a.Nil(err)
+		a.Nil(r.Unregister(context.Background(), node1))
+		a.Nil(r.Unregister(context.Background(), node2))
+	})
+	t.Run("Unregister revokes lease", func(t *testing.T) {
+		node1 := &discovery.ServiceNode{
+			ServiceName: "test",
+			IP:          net.IPv4(127, 0, 0, 1),
+			Port:        8484,
+		}
+		node2 := &discovery.ServiceNode{
+			ServiceName: "test",
+			IP:          net.IPv4(127, 0, 0, 2),
+			Port:        8484,
+		}
+		a.Nil(r.Register(context.Background(), node1))
+		a.Nil(r.Register(context.Background(), node2))
+		reg := r.(*registry)
+		reg.leaseMu.Lock()
+		lease := reg.lease
+		reg.leaseMu.Unlock()
+
+		// 仍有节点使用租约时保留租约
+		a.Nil(r.Unregister(context.Background(), node1))
+		resp, err := reg.client.TimeToLive(context.Background(), lease)
+		a.Nil(err)
+		a.Greater(resp.TTL, int64(0))
+
+		// 最后一个节点注销后撤销租约
+		a.Nil(r.Unregister(context.Background(), node2))
+		resp, err = reg.client.TimeToLive(context.Background(), lease)
+		a.Nil(err)
+		a.Equal(int64(-1), resp.TTL)
+		reg.leaseMu.Lock()
+		a.Equal(clientv3.LeaseID(0), reg.lease)
+		reg.leaseMu.Unlock()
+	})
+	t.Run("Resync nodes", func(t *testing.T) {
+		node := &discovery.ServiceNode{
+			ServiceName: "test",
+			IP:          net.IPv4(127, 0, 0, 1),
+			Port:        8484,
+		}
+		a.Nil(r.Register(context.Background(), node))
+		time.Sleep(time.Millisecond * 100)
+		// 模拟本地缓存与 etcd 不一致
+		reg := r.(*registry)
+		value, _ := reg.nodeListMap.Load("test")
+		value.(*sync.Map).Delete(reg.nodeKey(node))
+		value.(*sync.Map).Store("test/127.0.0.9:8484", node)
+
+		// 全量同步后与 etcd 保持一致
+		_, err := reg.resync("test")
+		a.Nil(err)
+		nodes, err := r.GetNodes(context.Background(), "test", nil)
+		a.Nil(err)
+		a.Equal([]*discovery.ServiceNode{node}, nodes)
+		a.Nil(r.Unregister(context.Background(), node))
+	})
+	t.Run("Close registry", func(t *testing.T) {
+		a.Nil(r.Close())
+		// 关闭后无法再拉取新的服务
+		_, err := r.GetNodes(context.Background(), "closed", nil)
+		a.ErrorIs(err, discovery.ErrRegistryClosed)
+		// 重复关闭
+		a.Nil(r.Close())
+	})
+}
+
+func TestEtcdRegistry_options(t *testing.T) {
+	a := assert.New(t)
+	client, err := clientv3.New(clientv3.Config{
+		Endpoints:   []string{"localhost:2379"},
+		DialTimeout: DialTimeout,
+	})
+	a.Nil(err)
+	defer client.Close()
+
+	r, err := NewRegistry(nil, WithClient(client), WithPrefix("/services/prod/"), WithLeaseTTL(5*time.Second))
+	a.Nil(err)
+	node := &discovery.ServiceNode{
+		ServiceName: "test",
+		IP:          net.IPv4(127, 0, 0, 1),
+		Port:        8484,
+	}
+	a.Nil(r.Register(context.Background(), node))
+
+	// 节点 key 位于根路径下
+	resp, err := client.Get(context.Background(), "/services/prod/test/127.0.0.1:8484")
+	a.Nil(err)
+	a.Len(resp.Kvs, 1)
+	ttl, err := client.TimeToLive(context.Background(), clientv3.LeaseID(resp.Kvs[0].Lease))
+	a.Nil(err)
+	a.LessOrEqual(ttl.GrantedTTL, int64(5))
+	nodes, err := r.GetNodes(context.Background(), "test", nil)
+	a.Nil(err)
+	a.Equal([]*discovery.ServiceNode{node}, nodes)
+
+	// 关闭注册中心不会关闭外部传入的客户端
+	a.Nil(r.Close())
+	resp, err = client.Get(context.Background(), "/services/prod/test/127.0.0.1:8484")
+	a.Nil(err)
+	a.Len(resp.Kvs, 0)
+}
+
+func TestNewRegistry_leaseTTL(t *testing.T) {
+	a := assert.New(t)
+	for ttl, expected := range map[time.Duration]time.Duration{
+		0:                       LeaseTTL,
+		-time.Second:            LeaseTTL,
+		500 * time.Millisecond:  time.Second,
+		1500 * time.Millisecond: 2 * time.Second,
+		5 * time.Second:         5 * time.Second,
+	} {
+		// 创建客户端时不会连接 etcd
+		r, err := NewRegistry([]string{"localhost:2379"}, WithLeaseTTL(ttl))
+		a.Nil(err)
+		a.Equal(expected, r.(*registry).options.leaseTTL)
+		a.Nil(r.Close())
+	}
 }
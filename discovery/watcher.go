@@ -0,0 +1,249 @@
+package discovery
+
+import (
+	"context"
+	"reflect"
+	"sort"
+	"sync"
+)
+
+// EventType 节点变更事件类型
+type EventType int
+
+const (
+	// EventSync 全量同步，订阅开始时推送一次
+	EventSync EventType = iota
+	// EventAdd 新增节点
+	EventAdd
+	// EventUpdate 节点信息变更
+	EventUpdate
+	// EventDelete 删除节点
+	EventDelete
+)
+
+// String 事件类型名称
+func (t EventType) String() string {
+	switch t {
+	case EventSync:
+		return "sync"
+	case EventAdd:
+		return "add"
+	case EventUpdate:
+		return "update"
+	case EventDelete:
+		return "delete"
+	}
+	return "unknown"
+}
+
+// Event 节点变更事件
+type Event struct {
+	Type EventType
+	// Node 发生变更的节点，EventSync 时为 nil
+	Node *ServiceNode
+	// Nodes 变更后满足标签条件的全部节点，订阅者之间共享，只读
+	Nodes []*ServiceNode
+}
+
+// Broadcaster 把注册中心本地缓存的变化广播给订阅者，各注册中心的 Watch 基于它实现
+type Broadcaster struct {
+	mu        sync.Mutex
+	closed    bool
+	snapshots map[string]map[string]*ServiceNode // <serviceName, <nodeKey, *ServiceNode>>
+	watchers  map[string]map[*watcher]struct{}   // <serviceName, watchers>
+}
+
+// NewBroadcaster 创建广播器
+func NewBroadcaster() *Broadcaster {
+	return &Broadcaster{
+		snapshots: make(map[string]map[string]*ServiceNode),
+		watchers:  make(map[string]map[*watcher]struct{}),
+	}
+}
+
+// Subscribe 订阅服务节点变化，nodes 为注册中心当前缓存的节点 <nodeKey, *ServiceNode>
+// 订阅后首先收到一个 EventSync 事件，ctx 结束或广播器关闭时 channel 被关闭
+func (b *Broadcaster) Subscribe(ctx context.Context, serviceName string, tags map[string]string, nodes *sync.Map) <-chan *Event {
+	w := &watcher{
+		tags:   tags,
+		notify: make(chan struct{}, 1),
+		out:    make(chan *Event),
+		done:   make(chan struct{}),
+	}
+
+	b.mu.Lock()
+	if b.closed {
+		b.mu.Unlock()
+		close(w.out)
+		return w.out
+	}
+	snapshot, exists := b.snapshots[serviceName]
+	if !exists {
+		snapshot = toNodeMap(nodes)
+		b.snapshots[serviceName] = snapshot
+	}
+	if b.watchers[serviceName] == nil {
+		b.watchers[serviceName] = make(map[*watcher]struct{})
+	}
+	b.watchers[serviceName][w] = struct{}{}
+	w.push([]*Event{{Type: EventSync, Nodes: sortedNodes(filterNodeMap(snapshot, tags))}})
+	b.mu.Unlock()
+
+	go func() {
+		w.run(ctx)
+		b.unsubscribe(serviceName, w)
+	}()
+	return w.out
+}
+
+// Publish 发布服务的最新节点 <nodeKey, *ServiceNode>，与上一次发布的结果比较后向订阅者推送差异
+func (b *Broadcaster) Publish(serviceName string, nodes *sync.Map) {
+	current := toNodeMap(nodes)
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.closed {
+		return
+	}
+	previous := b.snapshots[serviceName]
+	b.snapshots[serviceName] = current
+	for w := range b.watchers[serviceName] {
+		if events := diffNodes(filterNodeMap(previous, w.tags), filterNodeMap(current, w.tags)); len(events) > 0 {
+			w.push(events)
+		}
+	}
+}
+
+// Close 关闭所有订阅
+func (b *Broadcaster) Close() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.closed {
+		return
+	}
+	b.closed = true
+	for _, watchers := range b.watchers {
+		for w := range watchers {
+			close(w.done)
+		}
+	}
+	b.watchers = make(map[string]map[*watcher]struct{})
+}
+
+func (b *Broadcaster) unsubscribe(serviceName string, w *watcher) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	delete(b.watchers[serviceName], w)
+}
+
+// watcher 单个订阅者，事件先进入无界队列，避免慢消费者阻塞注册中心的监听协程
+type watcher struct {
+	tags   map[string]string
+	mu     sync.Mutex
+	queue  []*Event
+	notify chan struct{}
+	out    chan *Event
+	done   chan struct{}
+}
+
+func (w *watcher) push(events []*Event) {
+	w.mu.Lock()
+	w.queue = append(w.queue, events...)
+	w.mu.Unlock()
+	select {
+	case w.notify <- struct{}{}:
+	default:
+	}
+}
+
+func (w *watcher) run(ctx context.Context) {
+	defer close(w.out)
+	for {
+		w.mu.Lock()
+		events := w.queue
+		w.queue = nil
+		w.mu.Unlock()
+
+		for _, event := range events {
+			select {
+			case w.out <- event:
+			case <-ctx.Done():
+				return
+			case <-w.done:
+				return
+			}
+		}
+
+		select {
+		case <-w.notify:
+		case <-ctx.Done():
+			return
+		case <-w.done:
+			return
+		}
+	}
+}
+
+func toNodeMap(nodes *sync.Map) map[string]*ServiceNode {
+	result := make(map[string]*ServiceNode)
+	if nodes == nil {
+		return result
+	}
+	nodes.Range(func(key, value interface{}) bool {
+		result[key.(string)] = value.(*ServiceNode)
+		return true
+	})
+	return result
+}
+
+func filterNodeMap(nodes map[string]*ServiceNode, tags map[string]string) map[string]*ServiceNode {
+	if len(tags) == 0 {
+		return nodes
+	}
+	result := make(map[string]*ServiceNode, len(nodes))
+	for key, node := range nodes {
+		if MatchTags(node.Tags, tags) {
+			result[key] = node
+		}
+	}
+	return result
+}
+
+// diffNodes 比较两次节点快照，按节点 key 排序输出事件
+func diffNodes(previous, current map[string]*ServiceNode) []*Event {
+	snapshot := sortedNodes(current)
+	var events []*Event
+	for _, key := range sortedKeys(current) {
+		node := current[key]
+		old, exists := previous[key]
+		switch {
+		case !exists:
+			events = append(events, &Event{Type: EventAdd, Node: node, Nodes: snapshot})
+		case old != node && !reflect.DeepEqual(old, node):
+			events = append(events, &Event{Type: EventUpdate, Node: node, Nodes: snapshot})
+		}
+	}
+	for _, key := range sortedKeys(previous) {
+		if _, exists := current[key]; !exists {
+			events = append(events, &Event{Type: EventDelete, Node: previous[key], Nodes: snapshot})
+		}
+	}
+	return events
+}
+
+func sortedKeys(nodes map[string]*ServiceNode) []string {
+	keys := make([]string, 0, len(nodes))
+	for key := range nodes {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func sortedNodes(nodes map[string]*ServiceNode) []*ServiceNode {
+	result := make([]*ServiceNode, 0, len(nodes))
+	for _, key := range sortedKeys(nodes) {
+		result = append(result, nodes[key])
+	}
+	return result
+}
@@ -0,0 +1,120 @@
+package discovery
+
+import (
+	"context"
+	"github.com/stretchr/testify/assert"
+	"net"
+	"sync"
+	"testing"
+	"time"
+)
+
+func receiveEvent(t *testing.T, ch <-chan *Event) *Event {
+	select {
+	case event := <-ch:
+		return event
+	case <-time.After(time.Second):
+		t.Fatal("timeout waiting for event")
+		return nil
+	}
+}
+
+func TestBroadcaster(t *testing.T) {
+	a := assert.New(t)
+	node1 := &ServiceNode{
+		ServiceName: "test",
+		IP:          net.IPv4(127, 0, 0, 1),
+		Port:        8484,
+		Tags:        map[string]string{"version": "1.0"},
+	}
+	node2 := &ServiceNode{
+		ServiceName: "test",
+		IP:          net.IPv4(127, 0, 0, 2),
+		Port:        8484,
+		Tags:        map[string]string{"version": "2.0"},
+	}
+
+	b := NewBroadcaster()
+	defer b.Close()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	var nodes sync.Map
+	nodes.Store("127.0.0.1:8484", node1)
+	all := b.Subscribe(ctx, "test", nil, &nodes)
+	v1 := b.Subscribe(ctx, "test", map[string]string{"version": "1.0"}, &nodes)
+
+	// 首个事件为全量节点
+	event := receiveEvent(t, all)
+	a.Equal(EventSync, event.Type)
+	a.Equal([]*ServiceNode{node1}, event.Nodes)
+	event = receiveEvent(t, v1)
+	a.Equal(EventSync, event.Type)
+	a.Equal([]*ServiceNode{node1}, event.Nodes)
+
+	// 新增节点
+	nodes.Store("127.0.0.2:8484", node2)
+	b.Publish("test", &nodes)
+	event = receiveEvent(t, all)
+	a.Equal(EventAdd, event.Type)
+	a.Equal(node2, event.Node)
+	a.Equal([]*ServiceNode{node1, node2}, event.Nodes)
+
+	// 更新节点，标签变化后满足 version=1.0
+	updated := &ServiceNode{
+		ServiceName: "test",
+		IP:          net.IPv4(127, 0, 0, 2),
+		Port:        8484,
+		Tags:        map[string]string{"version": "1.0"},
+	}
+	nodes.Store("127.0.0.2:8484", updated)
+	b.Publish("test", &nodes)
+	event = receiveEvent(t, all)
+	a.Equal(EventUpdate, event.Type)
+	a.Equal(updated, event.Node)
+	event = receiveEvent(t, v1)
+	a.Equal(EventAdd, event.Type)
+	a.Equal(updated, event.Node)
+	a.Equal([]*ServiceNode{node1, updated}, event.Nodes)
+
+	// 内容相同的节点不产生事件
+	nodes.Store("127.0.0.1:8484", &ServiceNode{
+		ServiceName: "test",
+		IP:          net.IPv4(127, 0, 0, 1),
+		Port:        8484,
+		Tags:        map[string]string{"version": "1.0"},
+	})
+	b.Publish("test", &nodes)
+
+	// 删除节点
+	nodes.Delete("127.0.0.1:8484")
+	b.Publish("test", &nodes)
+	event = receiveEvent(t, all)
+	a.Equal(EventDelete, event.Type)
+	a.Equal("127.0.0.1", event.Node.IP.String())
+	a.Equal([]*ServiceNode{updated}, event.Nodes)
+	event = receiveEvent(t, v1)
+	a.Equal(EventDelete, event.Type)
+
+	// 取消订阅后 channel 被关闭
+	cancel()
+	_, ok := <-all
+	a.False(ok)
+}
+
+func TestBroadcaster_Close(t *testing.T) {
+	a := assert.New(t)
+	b := NewBroadcaster()
+	ch := b.Subscribe(context.Background(), "test", nil, nil)
+	event := receiveEvent(t, ch)
+	a.Equal(EventSync, event.Type)
+	a.Len(event.Nodes, 0)
+
+	b.Close()
+	_, ok := <-ch
+	a.False(ok)
+
+	// 关闭后订阅直接返回已关闭的 channel
+	_, ok = <-b.Subscribe(context.Background(), "test", nil, nil)
+	a.False(ok)
+}
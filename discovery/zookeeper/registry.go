@@ -20,26 +20,23 @@ var (
 
 type registry struct {
 	nodeListMap *sync.Map // <serviceName, <nodeKey, *ServiceNode>>
+	broadcaster *discovery.Broadcaster
 	conn        *zk.Conn
+
+	mu     sync.Mutex
+	closed bool
+	done   chan struct{} // Close 时关闭，通知watch协程退出
+	wg     sync.WaitGroup
 }
 
 func (r *registry) GetNodes(ctx context.Context, serviceName string, tags map[string]string) ([]*discovery.ServiceNode, error) {
-	nodes, exists := r.nodeListMap.Load(serviceName)
-	if !exists {
-		var err error
-		// 本地缓存为空，从 zookeeper 拉取
-		nodes, err = r.pullNodes(ctx, serviceName)
-		if err != nil {
-			return nil, err
-		}
-		// 缓存到本地
-		r.nodeListMap.Store(serviceName, nodes)
-		// 启动watch
-		go r.watchNodes(serviceName)
+	nodes, err := r.loadNodes(ctx, serviceName)
+	if err != nil {
+		return nil, err
 	}
 	// 按标签过滤节点
 	var filteredNodes []*discovery.ServiceNode
-	nodes.(*sync.Map).Range(func(key, value interface{}) bool {
+	nodes.Range(func(key, value interface{}) bool {
 		node := value.(*discovery.ServiceNode)
 		if discovery.MatchTags(node.Tags, tags) {
 			filteredNodes = append(filteredNodes, node)
@@ -50,6 +47,39 @@ func (r *registry) GetNodes(ctx context.Context, serviceName string, tags map[st
 	return filteredNodes, nil
 }
 
+func (r *registry) Watch(ctx context.Context, serviceName string, tags map[string]string) (<-chan *discovery.Event, error) {
+	nodes, err := r.loadNodes(ctx, serviceName)
+	if err != nil {
+		return nil, err
+	}
+	return r.broadcaster.Subscribe(ctx, serviceName, tags, nodes), nil
+}
+
+// loadNodes 读取本地缓存的服务节点，缓存为空时从 zookeeper 拉取并启动watch
+func (r *registry) loadNodes(ctx context.Context, serviceName string) (*sync.Map, error) {
+	if nodes, exists := r.nodeListMap.Load(serviceName); exists {
+		return nodes.(*sync.Map), nil
+	}
+	if r.isClosed() {
+		return nil, discovery.ErrRegistryClosed
+	}
+	// 本地缓存为空，从 zookeeper 拉取
+	nodes, err := r.pullNodes(ctx, serviceName)
+	if err != nil {
+		return nil, err
+	}
+	// 缓存到本地
+	actual, loaded := r.nodeListMap.LoadOrStore(serviceName, nodes)
+	if !loaded {
+		// 启动watch
+		if !r.spawn(func() { r.watchNodes(serviceName) }) {
+			r.nodeListMap.Delete(serviceName)
+			return nil, discovery.ErrRegistryClosed
+		}
+	}
+	return actual.(*sync.Map), nil
+}
+
 func (r *registry) Register(_ context.Context, node *discovery.ServiceNode) error {
 	if err := r.ensureServiceNode(node.ServiceName); err != nil {
 		return err
@@ -79,6 +109,38 @@ func (r *registry) Unregister(_ context.Context, node *discovery.ServiceNode) er
 	return nil
 }
 
+func (r *registry) Close() error {
+	r.mu.Lock()
+	if r.closed {
+		r.mu.Unlock()
+		return nil
+	}
+	r.closed = true
+	r.mu.Unlock()
+
+	// 关闭会话，本实例注册的临时节点随之删除
+	close(r.done)
+	r.conn.Close()
+	r.wg.Wait()
+	r.broadcaster.Close()
+	return nil
+}
+
+// spawn 在注册中心未关闭时启动后台协程，Close 会等待其退出
+func (r *registry) spawn(f func()) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.closed {
+		return false
+	}
+	r.wg.Add(1)
+	go func() {
+		defer r.wg.Done()
+		f()
+	}()
+	return true
+}
+
 func (r *registry) ensureServiceNode(name string) error {
 	nodePath := makeServicePath(name)
 	exists, _, err := r.conn.Exists(nodePath)
@@ -124,6 +186,9 @@ func (r *registry) watchNodes(name string) {
 	for {
 		children, _, ch, err := r.conn.ChildrenW(nodePath)
 		if err != nil {
+			if r.isClosed() {
+				return
+			}
 			fmt.Printf("failed to watch children of node %s: %v\n", nodePath, err)
 			return
 		}
@@ -143,12 +208,24 @@ func (r *registry) watchNodes(name string) {
 			nodes.Store(child, &node)
 		}
 		r.nodeListMap.Store(name, &nodes)
+		r.broadcaster.Publish(name, &nodes)
 		select {
 		case <-ch:
+		case <-r.done:
+			return
 		}
 	}
 }
 
+func (r *registry) isClosed() bool {
+	select {
+	case <-r.done:
+		return true
+	default:
+		return false
+	}
+}
+
 func NewRegistry(servers []string) (discovery.NodeRegistry, error) {
 	conn, _, err := zk.Connect(servers, DialTimeout)
 	if err != nil {
@@ -161,6 +238,8 @@ func NewRegistry(servers []string) (discovery.NodeRegistry, error) {
 	}
 	return &registry{
 		nodeListMap: &sync.Map{},
+		broadcaster: discovery.NewBroadcaster(),
 		conn:        conn,
+		done:        make(chan struct{}),
 	}, nil
 }
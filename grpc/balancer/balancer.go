@@ -0,0 +1,137 @@
+package balancer
+
+import (
+	"context"
+	"github.com/xialeistudio/go-service-discovery/discovery"
+	"github.com/xialeistudio/go-service-discovery/grpc/resolver"
+	"github.com/xialeistudio/go-service-discovery/loadbalancer"
+	gbalancer "google.golang.org/grpc/balancer"
+	"google.golang.org/grpc/balancer/base"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"net"
+	"strconv"
+	"sync"
+	"time"
+)
+
+type builder struct {
+	name string
+	lb   loadbalancer.LoadBalancer
+}
+
+// NewBuilder 创建 gRPC 负载均衡器，在就绪的连接中通过 lb 选择节点，请求结果反馈给 lb
+// 节点信息取自 resolver 包设置的地址属性，因此需要配合 resolver 包使用
+func NewBuilder(name string, lb loadbalancer.LoadBalancer) gbalancer.Builder {
+	return &builder{name: name, lb: lb}
+}
+
+func (b *builder) Build(cc gbalancer.ClientConn, opts gbalancer.BuildOptions) gbalancer.Balancer {
+	pb := &pickerBuilder{lb: b.lb}
+	return &discoveryBalancer{
+		Balancer:      base.NewBalancerBuilder(b.name, pb, base.Config{HealthCheck: true}).Build(cc, opts),
+		pickerBuilder: pb,
+	}
+}
+
+func (b *builder) Name() string {
+	return b.name
+}
+
+// discoveryBalancer 记录每个地址最新的节点信息
+// base 负载均衡器按地址复用连接时保留首次出现的地址，不会更新 BalancerAttributes 中的节点标签
+type discoveryBalancer struct {
+	gbalancer.Balancer
+	pickerBuilder *pickerBuilder
+}
+
+func (b *discoveryBalancer) UpdateClientConnState(s gbalancer.ClientConnState) error {
+	nodes := make(map[string]*discovery.ServiceNode, len(s.ResolverState.Addresses))
+	for _, addr := range s.ResolverState.Addresses {
+		if node, ok := resolver.NodeFromAddress(addr); ok {
+			nodes[addr.Addr] = node
+		}
+	}
+	b.pickerBuilder.mu.Lock()
+	b.pickerBuilder.nodes = nodes
+	b.pickerBuilder.mu.Unlock()
+	return b.Balancer.UpdateClientConnState(s)
+}
+
+func (b *discoveryBalancer) ExitIdle() {
+	if exitIdler, ok := b.Balancer.(gbalancer.ExitIdler); ok {
+		exitIdler.ExitIdle()
+	}
+}
+
+type pickerBuilder struct {
+	lb    loadbalancer.LoadBalancer
+	mu    sync.Mutex
+	nodes map[string]*discovery.ServiceNode // <ip:port, 最新的节点信息>
+}
+
+// Register 注册到 gRPC，通过 grpc.WithDefaultServiceConfig(`{"loadBalancingConfig":[{"name":{}}]}`) 启用
+func Register(name string, lb loadbalancer.LoadBalancer) {
+	gbalancer.Register(NewBuilder(name, lb))
+}
+
+func (b *pickerBuilder) Build(info base.PickerBuildInfo) gbalancer.Picker {
+	if len(info.ReadySCs) == 0 {
+		return base.NewErrPicker(gbalancer.ErrNoSubConnAvailable)
+	}
+	p := &picker{
+		lb:       b.lb,
+		nodes:    make([]*discovery.ServiceNode, 0, len(info.ReadySCs)),
+		subConns: make(map[*discovery.ServiceNode]gbalancer.SubConn, len(info.ReadySCs)),
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for subConn, subConnInfo := range info.ReadySCs {
+		node, ok := b.nodes[subConnInfo.Address.Addr]
+		if !ok {
+			node, ok = resolver.NodeFromAddress(subConnInfo.Address)
+		}
+		if !ok {
+			node = addressNode(subConnInfo.Address.Addr)
+		}
+		p.nodes = append(p.nodes, node)
+		p.subConns[node] = subConn
+	}
+	p.serviceName = p.nodes[0].ServiceName
+	return p
+}
+
+// addressNode 没有节点属性的地址（如直接指定的地址）只包含 ip 和端口
+func addressNode(addr string) *discovery.ServiceNode {
+	host, port, _ := net.SplitHostPort(addr)
+	p, _ := strconv.Atoi(port)
+	return &discovery.ServiceNode{IP: net.ParseIP(host), Port: p}
+}
+
+type picker struct {
+	lb          loadbalancer.LoadBalancer
+	serviceName string
+	nodes       []*discovery.ServiceNode
+	subConns    map[*discovery.ServiceNode]gbalancer.SubConn
+}
+
+func (p *picker) Pick(info gbalancer.PickInfo) (gbalancer.PickResult, error) {
+	node, done := p.lb.Select(info.Ctx, p.serviceName, p.nodes)
+	subConn, ok := p.subConns[node]
+	if !ok {
+		done(loadbalancer.DoneInfo{Err: context.Canceled})
+		return gbalancer.PickResult{}, gbalancer.ErrNoSubConnAvailable
+	}
+	start := time.Now()
+	return gbalancer.PickResult{
+		SubConn: subConn,
+		Done: func(info gbalancer.DoneInfo) {
+			err := info.Err
+			if status.Code(err) == codes.Canceled {
+				// 调用方取消的请求不作为判断节点好坏的依据
+				err = context.Canceled
+			}
+			done(loadbalancer.DoneInfo{Err: err, Latency: time.Since(start)})
+		},
+	}, nil
+}
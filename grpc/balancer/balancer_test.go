@@ -0,0 +1,138 @@
+package balancer
+
+import (
+	"context"
+	"github.com/stretchr/testify/assert"
+	"github.com/xialeistudio/go-service-discovery/discovery"
+	"github.com/xialeistudio/go-service-discovery/grpc/resolver"
+	"github.com/xialeistudio/go-service-discovery/loadbalancer"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/health"
+	"google.golang.org/grpc/health/grpc_health_v1"
+	gresolver "google.golang.org/grpc/resolver"
+	"google.golang.org/grpc/resolver/manual"
+	"net"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+)
+
+// countBalancer 记录反馈结果的负载均衡器
+type countBalancer struct {
+	inner loadbalancer.LoadBalancer
+	mu    sync.Mutex
+	done  map[string]int // <ip:port, 成功的请求数>
+}
+
+func (c *countBalancer) Select(ctx context.Context, serviceName string, nodes []*discovery.ServiceNode) (*discovery.ServiceNode, loadbalancer.DoneFunc) {
+	node, done := c.inner.Select(ctx, serviceName, nodes)
+	return node, func(info loadbalancer.DoneInfo) {
+		done(info)
+		if info.Err == nil {
+			c.mu.Lock()
+			c.done[node.Address()]++
+			c.mu.Unlock()
+		}
+	}
+}
+
+// startServer 启动提供健康检查服务的 gRPC 服务器
+func startServer(t *testing.T) *discovery.ServiceNode {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := grpc.NewServer()
+	grpc_health_v1.RegisterHealthServer(server, health.NewServer())
+	go func() { _ = server.Serve(ln) }()
+	t.Cleanup(server.Stop)
+
+	_, port, _ := net.SplitHostPort(ln.Addr().String())
+	p, _ := strconv.Atoi(port)
+	return &discovery.ServiceNode{ServiceName: "test", IP: net.IPv4(127, 0, 0, 1), Port: p}
+}
+
+func TestNewBuilder(t *testing.T) {
+	a := assert.New(t)
+	nodes := []*discovery.ServiceNode{startServer(t), startServer(t)}
+	lb := &countBalancer{inner: loadbalancer.NewRoundRobin(), done: make(map[string]int)}
+	Register("test_discovery", lb)
+
+	r := manual.NewBuilderWithScheme("test")
+	r.InitialState(gresolver.State{Addresses: []gresolver.Address{resolver.NewAddress(nodes[0]), resolver.NewAddress(nodes[1])}})
+	conn, err := grpc.Dial("test:///test",
+		grpc.WithResolvers(r),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+		grpc.WithDefaultServiceConfig(`{"loadBalancingConfig":[{"test_discovery":{}}]}`),
+	)
+	a.Nil(err)
+	defer conn.Close()
+
+	client := grpc_health_v1.NewHealthClient(conn)
+	for i := 0; i < 10; i++ {
+		_, err := client.Check(context.Background(), &grpc_health_v1.HealthCheckRequest{}, grpc.WaitForReady(true))
+		a.Nil(err)
+	}
+
+	// 选择委托给 lb，请求结果反馈给 lb
+	lb.mu.Lock()
+	defer lb.mu.Unlock()
+	total := 0
+	for _, count := range lb.done {
+		total += count
+	}
+	a.Equal(10, total)
+}
+
+// tagsBalancer 记录最近一次选择时看到的节点标签
+type tagsBalancer struct {
+	inner loadbalancer.LoadBalancer
+	mu    sync.Mutex
+	tags  map[string]string
+}
+
+func (b *tagsBalancer) Select(ctx context.Context, serviceName string, nodes []*discovery.ServiceNode) (*discovery.ServiceNode, loadbalancer.DoneFunc) {
+	node, done := b.inner.Select(ctx, serviceName, nodes)
+	b.mu.Lock()
+	b.tags = node.Tags
+	b.mu.Unlock()
+	return node, done
+}
+
+func TestNewBuilder_tags(t *testing.T) {
+	a := assert.New(t)
+	node := startServer(t)
+	node.Tags = map[string]string{"version": "1.0"}
+	lb := &tagsBalancer{inner: loadbalancer.NewRoundRobin()}
+	Register("test_discovery_tags", lb)
+
+	r := manual.NewBuilderWithScheme("test")
+	r.InitialState(gresolver.State{Addresses: []gresolver.Address{resolver.NewAddress(node)}})
+	conn, err := grpc.Dial("test:///test",
+		grpc.WithResolvers(r),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+		grpc.WithDefaultServiceConfig(`{"loadBalancingConfig":[{"test_discovery_tags":{}}]}`),
+	)
+	a.Nil(err)
+	defer conn.Close()
+
+	client := grpc_health_v1.NewHealthClient(conn)
+	tags := func() map[string]string {
+		_, err := client.Check(context.Background(), &grpc_health_v1.HealthCheckRequest{}, grpc.WaitForReady(true))
+		a.Nil(err)
+		lb.mu.Lock()
+		defer lb.mu.Unlock()
+		return lb.tags
+	}
+	a.Equal(map[string]string{"version": "1.0"}, tags())
+
+	// 节点标签变化后 lb 看到最新的标签
+	updated := *node
+	updated.Tags = map[string]string{"version": "2.0"}
+	r.UpdateState(gresolver.State{Addresses: []gresolver.Address{resolver.NewAddress(&updated)}})
+	a.Eventually(func() bool {
+		return tags()["version"] == "2.0"
+	}, time.Second, 10*time.Millisecond)
+}
@@ -0,0 +1,119 @@
+package resolver
+
+import (
+	"context"
+	"github.com/xialeistudio/go-service-discovery/discovery"
+	"google.golang.org/grpc/attributes"
+	gresolver "google.golang.org/grpc/resolver"
+	"reflect"
+	"strings"
+	"sync"
+)
+
+// Scheme 服务发现的 gRPC 目标地址 scheme，目标地址形如 discovery:///service-name?version=1.0，查询参数作为节点标签过滤条件
+const Scheme = "discovery"
+
+type nodeKey struct{}
+
+// nodeAttribute 包装 *ServiceNode，实现 Equal 以便 gRPC 比较地址属性
+type nodeAttribute struct {
+	node *discovery.ServiceNode
+}
+
+func (a nodeAttribute) Equal(o interface{}) bool {
+	other, ok := o.(nodeAttribute)
+	return ok && reflect.DeepEqual(a.node, other.node)
+}
+
+// NewAddress 把服务节点转换为 gRPC 地址，节点（包括标签）保存在 BalancerAttributes 中，标签变化不会导致重新建立连接
+func NewAddress(node *discovery.ServiceNode) gresolver.Address {
+	return gresolver.Address{
+		Addr:               node.Address(),
+		ServerName:         node.ServiceName,
+		BalancerAttributes: attributes.New(nodeKey{}, nodeAttribute{node: node}),
+	}
+}
+
+// NodeFromAddress 读取地址对应的服务节点
+func NodeFromAddress(addr gresolver.Address) (*discovery.ServiceNode, bool) {
+	attribute, ok := addr.BalancerAttributes.Value(nodeKey{}).(nodeAttribute)
+	return attribute.node, ok
+}
+
+// TagsFromAddress 读取地址对应的节点标签
+func TagsFromAddress(addr gresolver.Address) map[string]string {
+	if node, ok := NodeFromAddress(addr); ok {
+		return node.Tags
+	}
+	return nil
+}
+
+type builder struct {
+	registry discovery.NodeRegistry
+}
+
+// NewBuilder 创建 gRPC 名字解析器，通过 registry 监听节点变化并推送给 gRPC
+func NewBuilder(registry discovery.NodeRegistry) gresolver.Builder {
+	return &builder{registry: registry}
+}
+
+// Register 注册到 gRPC 的全局解析器，之后可以直接使用 discovery:///service-name 作为目标地址
+func Register(registry discovery.NodeRegistry) {
+	gresolver.Register(NewBuilder(registry))
+}
+
+func (b *builder) Build(target gresolver.Target, cc gresolver.ClientConn, _ gresolver.BuildOptions) (gresolver.Resolver, error) {
+	serviceName := strings.TrimPrefix(target.URL.Path, "/")
+	var tags map[string]string
+	if query := target.URL.Query(); len(query) > 0 {
+		tags = make(map[string]string, len(query))
+		for name := range query {
+			tags[name] = query.Get(name)
+		}
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	events, err := b.registry.Watch(ctx, serviceName, tags)
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+	r := &discoveryResolver{cancel: cancel}
+	r.wg.Add(1)
+	go func() {
+		defer r.wg.Done()
+		r.watch(ctx, cc, events)
+	}()
+	return r, nil
+}
+
+func (b *builder) Scheme() string {
+	return Scheme
+}
+
+type discoveryResolver struct {
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+}
+
+// watch 把节点变化推送给 gRPC，注册中心关闭导致监听结束时报告错误
+func (r *discoveryResolver) watch(ctx context.Context, cc gresolver.ClientConn, events <-chan *discovery.Event) {
+	for event := range events {
+		addresses := make([]gresolver.Address, 0, len(event.Nodes))
+		for _, node := range event.Nodes {
+			addresses = append(addresses, NewAddress(node))
+		}
+		_ = cc.UpdateState(gresolver.State{Addresses: addresses})
+	}
+	if ctx.Err() == nil {
+		cc.ReportError(discovery.ErrRegistryClosed)
+	}
+}
+
+// ResolveNow 节点变化由注册中心主动推送，无需处理
+func (r *discoveryResolver) ResolveNow(gresolver.ResolveNowOptions) {}
+
+func (r *discoveryResolver) Close() {
+	r.cancel()
+	r.wg.Wait()
+}
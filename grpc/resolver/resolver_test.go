@@ -0,0 +1,99 @@
+package resolver
+
+import (
+	"context"
+	"github.com/stretchr/testify/assert"
+	"github.com/xialeistudio/go-service-discovery/discovery"
+	gresolver "google.golang.org/grpc/resolver"
+	"net"
+	"net/url"
+	"sync"
+	"testing"
+	"time"
+)
+
+// watchRegistry 基于内存的注册中心，仅实现 Watch
+type watchRegistry struct {
+	discovery.NodeRegistry
+	nodes       sync.Map
+	broadcaster *discovery.Broadcaster
+}
+
+func (r *watchRegistry) Watch(ctx context.Context, serviceName string, tags map[string]string) (<-chan *discovery.Event, error) {
+	return r.broadcaster.Subscribe(ctx, serviceName, tags, &r.nodes), nil
+}
+
+func (r *watchRegistry) store(node *discovery.ServiceNode) {
+	r.nodes.Store(node.Address(), node)
+	r.broadcaster.Publish(node.ServiceName, &r.nodes)
+}
+
+// recordClientConn 记录解析结果的 gresolver.ClientConn
+type recordClientConn struct {
+	gresolver.ClientConn
+	states chan gresolver.State
+	errs   chan error
+}
+
+func (c *recordClientConn) UpdateState(state gresolver.State) error {
+	c.states <- state
+	return nil
+}
+
+func (c *recordClientConn) ReportError(err error) {
+	c.errs <- err
+}
+
+func receiveState(t *testing.T, cc *recordClientConn) gresolver.State {
+	select {
+	case state := <-cc.states:
+		return state
+	case <-time.After(time.Second):
+		t.Fatal("timeout waiting for state")
+		return gresolver.State{}
+	}
+}
+
+func TestBuilder(t *testing.T) {
+	a := assert.New(t)
+	node1 := &discovery.ServiceNode{ServiceName: "test", IP: net.IPv4(127, 0, 0, 1), Port: 8484, Tags: map[string]string{"version": "1.0"}}
+	node2 := &discovery.ServiceNode{ServiceName: "test", IP: net.IPv4(127, 0, 0, 2), Port: 8484, Tags: map[string]string{"version": "2.0"}}
+	node3 := &discovery.ServiceNode{ServiceName: "test", IP: net.IPv4(127, 0, 0, 3), Port: 8484, Tags: map[string]string{"version": "1.0"}}
+	registry := &watchRegistry{broadcaster: discovery.NewBroadcaster()}
+	defer registry.broadcaster.Close()
+	registry.store(node1)
+	registry.store(node2)
+
+	b := NewBuilder(registry)
+	a.Equal(Scheme, b.Scheme())
+	cc := &recordClientConn{states: make(chan gresolver.State, 10), errs: make(chan error, 1)}
+	target, err := url.Parse("discovery:///test?version=1.0")
+	a.Nil(err)
+	r, err := b.Build(gresolver.Target{URL: *target}, cc, gresolver.BuildOptions{})
+	a.Nil(err)
+	defer r.Close()
+
+	// 首先推送全量节点，标签作为地址属性
+	state := receiveState(t, cc)
+	a.Len(state.Addresses, 1)
+	a.Equal("127.0.0.1:8484", state.Addresses[0].Addr)
+	a.Equal(map[string]string{"version": "1.0"}, TagsFromAddress(state.Addresses[0]))
+	node, ok := NodeFromAddress(state.Addresses[0])
+	a.True(ok)
+	a.Equal(node1, node)
+
+	// 节点变化后推送最新节点
+	registry.store(node3)
+	state = receiveState(t, cc)
+	a.Len(state.Addresses, 2)
+	a.Equal("127.0.0.3:8484", state.Addresses[1].Addr)
+
+	// 注册中心关闭后报告错误
+	registry.broadcaster.Close()
+	select {
+	case err := <-cc.errs:
+		a.ErrorIs(err, discovery.ErrRegistryClosed)
+	case <-time.After(time.Second):
+		t.Fatal("timeout waiting for error")
+	}
+}
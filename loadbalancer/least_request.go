@@ -0,0 +1,75 @@
+package loadbalancer
+
+import (
+	"context"
+	"github.com/xialeistudio/go-service-discovery/discovery"
+	"math/rand"
+	"sync"
+	"time"
+)
+
+type leastRequest struct {
+	mu       sync.Mutex
+	r        *rand.Rand
+	inflight map[string]int64 // <ip:port, 未完成的请求数>
+}
+
+func (l *leastRequest) Select(_ context.Context, nodes []*discovery.ServiceNode) (*discovery.ServiceNode, DoneFunc) {
+	if len(nodes) == 0 {
+		return nil, noopDone
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	var (
+		selected     *discovery.ServiceNode
+		bestInflight int64
+		bestWeight   int64
+		ties         = 1
+	)
+	for _, node := range nodes {
+		inflight := l.inflight[node.Address()]
+		weight := int64(nodeWeight(node))
+		if selected != nil {
+			// 比较 (inflight+1)/weight，交叉相乘避免浮点运算
+			current, best := (inflight+1)*bestWeight, (bestInflight+1)*weight
+			if current > best {
+				continue
+			}
+			// 分数相同的节点中等概率随机选择
+			if current == best {
+				ties++
+				if l.r.Intn(ties) != 0 {
+					continue
+				}
+			} else {
+				ties = 1
+			}
+		}
+		selected, bestInflight, bestWeight = node, inflight, weight
+	}
+
+	key := selected.Address()
+	l.inflight[key]++
+	var once sync.Once
+	return selected, func(DoneInfo) {
+		once.Do(func() {
+			l.mu.Lock()
+			defer l.mu.Unlock()
+			if l.inflight[key]--; l.inflight[key] <= 0 {
+				delete(l.inflight, key)
+			}
+		})
+	}
+}
+
+// NewLeastRequest 最少请求数，选择未完成请求数与权重之比最小的节点
+func NewLeastRequest() LoadBalancer {
+	return New(func() Balancer {
+		return &leastRequest{
+			r:        rand.New(rand.NewSource(time.Now().UnixNano())),
+			inflight: make(map[string]int64),
+		}
+	})
+}
@@ -0,0 +1,97 @@
+package loadbalancer
+
+import (
+	"context"
+	"github.com/stretchr/testify/assert"
+	"github.com/xialeistudio/go-service-discovery/discovery"
+	"math/rand"
+	"net"
+	"testing"
+)
+
+func Test_leastRequest_Select(t *testing.T) {
+	a := assert.New(t)
+	lb := &leastRequest{
+		r:        rand.New(rand.NewSource(1)),
+		inflight: make(map[string]int64),
+	}
+	nodes := []*discovery.ServiceNode{
+		{
+			ServiceName: "test",
+			IP:          net.IPv4(127, 0, 0, 1),
+			Port:        8484,
+			Tags:        map[string]string{},
+		},
+		{
+			ServiceName: "test",
+			IP:          net.IPv4(127, 0, 0, 2),
+			Port:        8484,
+			Tags:        map[string]string{},
+		},
+		{
+			ServiceName: "test",
+			IP:          net.IPv4(127, 0, 0, 3),
+			Port:        8484,
+			Tags:        map[string]string{},
+		},
+	}
+
+	// 请求未完成时依次选择不同的节点
+	selected := make(map[*discovery.ServiceNode]DoneFunc)
+	for i := 0; i < 3; i++ {
+		node, done := lb.Select(context.Background(), nodes)
+		a.NotContains(selected, node)
+		selected[node] = done
+	}
+	a.Len(selected, 3)
+
+	// 请求完成后该节点的请求数最少
+	selected[nodes[1]](DoneInfo{})
+	node, done := lb.Select(context.Background(), nodes)
+	a.Equal(nodes[1], node)
+	done(DoneInfo{})
+	// 重复回调不会重复扣减
+	done(DoneInfo{})
+	a.Equal(int64(1), lb.inflight[nodes[0].Address()])
+	a.Equal(int64(0), lb.inflight[nodes[1].Address()])
+
+	for _, done := range selected {
+		done(DoneInfo{})
+	}
+	a.Empty(lb.inflight)
+}
+
+func Test_leastRequest_Select_weighted(t *testing.T) {
+	a := assert.New(t)
+	lb := &leastRequest{
+		r:        rand.New(rand.NewSource(1)),
+		inflight: make(map[string]int64),
+	}
+	nodes := []*discovery.ServiceNode{
+		{
+			ServiceName: "test",
+			IP:          net.IPv4(127, 0, 0, 1),
+			Port:        8484,
+			Tags: map[string]string{
+				"weight": "3",
+			},
+		},
+		{
+			ServiceName: "test",
+			IP:          net.IPv4(127, 0, 0, 2),
+			Port:        8484,
+			Tags: map[string]string{
+				"weight": "1",
+			},
+		},
+	}
+
+	// 请求都不结束时，节点上的请求数与权重成正比
+	counts := make(map[*discovery.ServiceNode]int)
+	for i := 0; i < 40; i++ {
+		node, _ := lb.Select(context.Background(), nodes)
+		counts[node]++
+	}
+	a.Equal(30, counts[nodes[0]])
+	a.Equal(10, counts[nodes[1]])
+}
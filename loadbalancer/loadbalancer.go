@@ -1,7 +1,123 @@
 package loadbalancer
 
-import "github.com/xialeistudio/go-service-discovery/discovery"
+import (
+	"context"
+	"github.com/spf13/cast"
+	"github.com/xialeistudio/go-service-discovery/discovery"
+	"hash/fnv"
+	"sync"
+	"time"
+)
 
+// DoneInfo 请求结果，调用方在请求结束后通过 DoneFunc 反馈给负载均衡器
+type DoneInfo struct {
+	// Err 请求错误，nil 表示成功
+	// context.Canceled 表示请求被放弃（如慢启动放弃本次选择、对冲请求落选），不能作为判断节点好坏的依据
+	Err error
+	// Latency 请求耗时
+	Latency time.Duration
+	// BytesSent 发送的字节数，未知时为 0
+	BytesSent int64
+	// BytesReceived 接收的字节数，未知时为 0
+	BytesReceived int64
+}
+
+// DoneFunc 请求结束回调，每次选择后必须调用且只调用一次
+type DoneFunc func(info DoneInfo)
+
+// LoadBalancer 负载均衡器，各服务的选择状态相互隔离
 type LoadBalancer interface {
-	Select(nodes []*discovery.ServiceNode) *discovery.ServiceNode
+	// Select 从服务节点中选择一个节点，返回的 DoneFunc 不为 nil
+	Select(ctx context.Context, serviceName string, nodes []*discovery.ServiceNode) (*discovery.ServiceNode, DoneFunc)
+}
+
+// Balancer 单个服务的负载均衡策略
+type Balancer interface {
+	// Select 从服务节点中选择一个节点，返回的 DoneFunc 不为 nil
+	Select(ctx context.Context, nodes []*discovery.ServiceNode) (*discovery.ServiceNode, DoneFunc)
+}
+
+// Factory 负载均衡策略工厂，为每个服务创建独立的 Balancer
+type Factory func() Balancer
+
+type loadBalancer struct {
+	factory   Factory
+	balancers sync.Map // <serviceName, Balancer>
+}
+
+func (l *loadBalancer) Select(ctx context.Context, serviceName string, nodes []*discovery.ServiceNode) (*discovery.ServiceNode, DoneFunc) {
+	balancer, exists := l.balancers.Load(serviceName)
+	if !exists {
+		balancer, _ = l.balancers.LoadOrStore(serviceName, l.factory())
+	}
+	return balancer.(Balancer).Select(ctx, nodes)
+}
+
+// New 创建负载均衡器，首次选择某个服务时通过 factory 创建该服务的 Balancer
+func New(factory Factory) LoadBalancer {
+	return &loadBalancer{factory: factory}
+}
+
+// noopDone 不关心请求结果的策略使用
+func noopDone(DoneInfo) {}
+
+type hashKeyContextKey struct{}
+
+// WithHashKey 设置请求的哈希键（如用户 ID、缓存 key），供一致性哈希类策略选择节点
+func WithHashKey(ctx context.Context, key string) context.Context {
+	return context.WithValue(ctx, hashKeyContextKey{}, key)
+}
+
+// HashKeyFromContext 读取请求的哈希键
+func HashKeyFromContext(ctx context.Context) (string, bool) {
+	if ctx == nil {
+		return "", false
+	}
+	key, ok := ctx.Value(hashKeyContextKey{}).(string)
+	return key, ok
+}
+
+// nodeWeight 节点权重，取自 weight 标签，缺失或不合法时为 1
+func nodeWeight(node *discovery.ServiceNode) int {
+	weight, err := cast.ToIntE(node.Tags["weight"])
+	if err != nil || weight <= 0 {
+		return 1
+	}
+	return weight
+}
+
+// nodeSet 节点集合，注册中心每次返回的节点顺序可能不同，用于与顺序无关地判断节点是否变动
+type nodeSet map[*discovery.ServiceNode]struct{}
+
+func newNodeSet(nodes []*discovery.ServiceNode) nodeSet {
+	set := make(nodeSet, len(nodes))
+	for _, node := range nodes {
+		set[node] = struct{}{}
+	}
+	return set
+}
+
+func (s nodeSet) equal(nodes []*discovery.ServiceNode) bool {
+	if len(s) != len(nodes) {
+		return false
+	}
+	for _, node := range nodes {
+		if _, exists := s[node]; !exists {
+			return false
+		}
+	}
+	return true
+}
+
+// hashString 64 位哈希，fnv-1a 之后再做一次 splitmix64 混淆，使相近的字符串分布更均匀
+func hashString(s string) uint64 {
+	h := fnv.New64a()
+	_, _ = h.Write([]byte(s))
+	x := h.Sum64()
+	x ^= x >> 30
+	x *= 0xbf58476d1ce4e5b9
+	x ^= x >> 27
+	x *= 0x94d049bb133111eb
+	x ^= x >> 31
+	return x
 }
@@ -0,0 +1,135 @@
+package loadbalancer
+
+import (
+	"context"
+	"github.com/xialeistudio/go-service-discovery/discovery"
+	"math/rand"
+	"sort"
+	"sync"
+	"time"
+)
+
+// DefaultTableSize Maglev 查找表的默认大小，必须为质数，建议不小于节点数的 100 倍
+var DefaultTableSize = 65537
+
+type maglev struct {
+	mu        sync.Mutex
+	r         *rand.Rand
+	tableSize int
+	members   nodeSet
+	nodes     []*discovery.ServiceNode // 按地址排序
+	table     []int32                  // <slot, nodes 下标>
+}
+
+func (m *maglev) Select(ctx context.Context, nodes []*discovery.ServiceNode) (*discovery.ServiceNode, DoneFunc) {
+	if len(nodes) == 0 {
+		return nil, noopDone
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	// 节点变动时重建查找表
+	if !m.members.equal(nodes) {
+		m.members = newNodeSet(nodes)
+		m.nodes, m.table = buildMaglevTable(nodes, m.tableSize)
+	}
+
+	key, ok := HashKeyFromContext(ctx)
+	if !ok {
+		// 没有哈希键时随机选择
+		return nodes[m.r.Intn(len(nodes))], noopDone
+	}
+	return m.nodes[m.table[hashString(key)%uint64(len(m.table))]], noopDone
+}
+
+// buildMaglevTable 按 Maglev 论文的方式填充查找表，权重越大的节点每轮越早、越频繁地占位
+func buildMaglevTable(nodes []*discovery.ServiceNode, tableSize int) ([]*discovery.ServiceNode, []int32) {
+	// 排序保证不同客户端构建出相同的查找表
+	sorted := make([]*discovery.ServiceNode, len(nodes))
+	copy(sorted, nodes)
+	sort.Slice(sorted, func(i, j int) bool {
+		return sorted[i].Address() < sorted[j].Address()
+	})
+
+	size := uint64(tableSize)
+	type entry struct {
+		offset, skip, next uint64
+		weight, target     uint64
+	}
+	entries := make([]entry, len(sorted))
+	var maxWeight uint64
+	for i, node := range sorted {
+		address := node.Address()
+		entries[i] = entry{
+			offset: hashString("offset:"+address) % size,
+			skip:   hashString("skip:"+address)%(size-1) + 1,
+			weight: uint64(nodeWeight(node)),
+		}
+		if entries[i].weight > maxWeight {
+			maxWeight = entries[i].weight
+		}
+	}
+
+	table := make([]int32, size)
+	for i := range table {
+		table[i] = -1
+	}
+	filled := uint64(0)
+	for round := uint64(1); filled < size; round++ {
+		for i := range entries {
+			if filled == size {
+				break
+			}
+			e := &entries[i]
+			// 权重为最大权重 1/k 的节点每 k 轮占一个位置
+			if round*e.weight < e.target {
+				continue
+			}
+			e.target += maxWeight
+			slot := (e.offset + e.skip*e.next) % size
+			for table[slot] >= 0 {
+				e.next++
+				slot = (e.offset + e.skip*e.next) % size
+			}
+			table[slot] = int32(i)
+			e.next++
+			filled++
+		}
+	}
+	return sorted, table
+}
+
+// nextPrime 大于等于 n 的最小质数
+func nextPrime(n int) int {
+	if n <= 2 {
+		return 2
+	}
+	for ; ; n++ {
+		prime := true
+		for i := 2; i*i <= n; i++ {
+			if n%i == 0 {
+				prime = false
+				break
+			}
+		}
+		if prime {
+			return n
+		}
+	}
+}
+
+// NewMaglev Maglev 一致性哈希，通过 WithHashKey 传入请求的哈希键，查找表选择节点的复杂度为 O(1)
+// tableSize 为查找表大小，不是质数时取下一个质数，0 表示使用 DefaultTableSize
+func NewMaglev(tableSize int) LoadBalancer {
+	if tableSize <= 0 {
+		tableSize = DefaultTableSize
+	}
+	tableSize = nextPrime(tableSize)
+	return New(func() Balancer {
+		return &maglev{
+			r:         rand.New(rand.NewSource(time.Now().UnixNano())),
+			tableSize: tableSize,
+		}
+	})
+}
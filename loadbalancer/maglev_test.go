@@ -0,0 +1,85 @@
+package loadbalancer
+
+import (
+	"context"
+	"github.com/stretchr/testify/assert"
+	"github.com/xialeistudio/go-service-discovery/discovery"
+	"math/rand"
+	"strconv"
+	"testing"
+)
+
+func Test_maglev_Select(t *testing.T) {
+	a := assert.New(t)
+	lb := &maglev{r: rand.New(rand.NewSource(1)), tableSize: DefaultTableSize}
+	nodes := newHashTestNodes(4)
+
+	// 相同的键总是选中相同的节点，与节点顺序无关
+	node := selectByKey(lb, nodes, "user-1")
+	a.Equal(node, selectByKey(lb, nodes, "user-1"))
+	reversed := []*discovery.ServiceNode{nodes[3], nodes[2], nodes[1], nodes[0]}
+	a.Equal(node, selectByKey(lb, reversed, "user-1"))
+	// 不同实例构建出相同的查找表
+	other := &maglev{r: rand.New(rand.NewSource(2)), tableSize: DefaultTableSize}
+	a.Equal(node, selectByKey(other, nodes, "user-1"))
+
+	// 没有哈希键时随机选择
+	node, _ = lb.Select(context.Background(), nodes)
+	a.NotNil(node)
+}
+
+func Test_maglev_Select_distribution(t *testing.T) {
+	a := assert.New(t)
+	lb := &maglev{r: rand.New(rand.NewSource(1)), tableSize: DefaultTableSize}
+	nodes := newHashTestNodes(10)
+	selectByKey(lb, nodes, "")
+
+	// 查找表中各节点占位数基本相同
+	counts := make(map[int32]int)
+	for _, index := range lb.table {
+		counts[index]++
+	}
+	a.Len(counts, 10)
+	for _, count := range counts {
+		a.InDelta(float64(DefaultTableSize)/10, count, float64(DefaultTableSize)/10*0.02)
+	}
+
+	// 新增节点时迁移的键约占 1/11
+	const keys = 10000
+	before := make([]*discovery.ServiceNode, keys)
+	for i := range before {
+		before[i] = selectByKey(lb, nodes, "key-"+strconv.Itoa(i))
+	}
+	nodes = append(nodes, newHashTestNodes(11)[10])
+	moved := 0
+	for i := range before {
+		if selectByKey(lb, nodes, "key-"+strconv.Itoa(i)) != before[i] {
+			moved++
+		}
+	}
+	a.InDelta(1.0/11, float64(moved)/keys, 0.03)
+}
+
+func Test_maglev_Select_weighted(t *testing.T) {
+	a := assert.New(t)
+	lb := &maglev{r: rand.New(rand.NewSource(1)), tableSize: DefaultTableSize}
+	nodes := newHashTestNodes(2)
+	nodes[0].Tags["weight"] = "3"
+	nodes[1].Tags["weight"] = "1"
+	selectByKey(lb, nodes, "")
+
+	count := 0
+	for _, index := range lb.table {
+		if lb.nodes[index] == nodes[0] {
+			count++
+		}
+	}
+	a.InDelta(0.75, float64(count)/float64(len(lb.table)), 0.01)
+}
+
+func Test_nextPrime(t *testing.T) {
+	a := assert.New(t)
+	a.Equal(2, nextPrime(0))
+	a.Equal(11, nextPrime(10))
+	a.Equal(65537, nextPrime(65537))
+}
@@ -0,0 +1,153 @@
+package loadbalancer
+
+import (
+	"context"
+	"errors"
+	"github.com/xialeistudio/go-service-discovery/discovery"
+	"math"
+	"math/rand"
+	"sync"
+	"time"
+)
+
+var (
+	// DefaultDecay P2C 延迟统计的默认衰减时间
+	DefaultDecay = 10 * time.Second
+	// DefaultRTT 尚无延迟数据但已有请求在途的节点按该延迟计算分数，避免新节点在首个响应返回前被大量选中
+	DefaultRTT = time.Second
+)
+
+type ewmaStats struct {
+	cost     float64   // 延迟的指数加权移动平均（纳秒），出现更高延迟时立即取峰值
+	stamp    time.Time // 上次更新 cost 的时间
+	inflight int64     // 未完成的请求数
+}
+
+type p2c struct {
+	mu        sync.Mutex
+	r         *rand.Rand
+	decay     time.Duration
+	now       func() time.Time
+	stats     map[string]*ewmaStats // <ip:port, 统计数据>
+	lastPrune time.Time
+}
+
+func (p *p2c) Select(_ context.Context, nodes []*discovery.ServiceNode) (*discovery.ServiceNode, DoneFunc) {
+	if len(nodes) == 0 {
+		return nil, noopDone
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	now := p.now()
+	p.prune(nodes, now)
+
+	node := nodes[0]
+	if len(nodes) > 1 {
+		// 随机选择两个不同的节点，取分数较低者
+		i := p.r.Intn(len(nodes))
+		j := p.r.Intn(len(nodes) - 1)
+		if j >= i {
+			j++
+		}
+		node = nodes[i]
+		if p.score(nodes[j], now) < p.score(node, now) {
+			node = nodes[j]
+		}
+	}
+
+	key := node.Address()
+	stats := p.stats[key]
+	if stats == nil {
+		stats = &ewmaStats{stamp: now}
+		p.stats[key] = stats
+	}
+	stats.inflight++
+
+	var once sync.Once
+	return node, func(info DoneInfo) {
+		once.Do(func() {
+			p.mu.Lock()
+			defer p.mu.Unlock()
+			end := p.now()
+			latency := info.Latency
+			if latency <= 0 {
+				latency = end.Sub(now)
+			}
+			stats.inflight--
+			if !errors.Is(info.Err, context.Canceled) {
+				stats.observe(float64(latency), end, p.decay)
+			}
+		})
+	}
+}
+
+// score 节点分数，延迟越高、在途请求越多分数越高，按权重折算
+func (p *p2c) score(node *discovery.ServiceNode, now time.Time) float64 {
+	stats := p.stats[node.Address()]
+	if stats == nil {
+		return 0
+	}
+	cost := stats.decayedCost(now, p.decay)
+	if cost == 0 && stats.inflight > 0 {
+		cost = float64(DefaultRTT)
+	}
+	return cost * float64(stats.inflight+1) / float64(nodeWeight(node))
+}
+
+// prune 每个衰减周期清理一次已下线节点的统计数据
+func (p *p2c) prune(nodes []*discovery.ServiceNode, now time.Time) {
+	if now.Sub(p.lastPrune) < p.decay {
+		return
+	}
+	p.lastPrune = now
+	alive := make(map[string]struct{}, len(nodes))
+	for _, node := range nodes {
+		alive[node.Address()] = struct{}{}
+	}
+	for key, stats := range p.stats {
+		if _, exists := alive[key]; !exists && stats.inflight <= 0 {
+			delete(p.stats, key)
+		}
+	}
+}
+
+// observe 记录一次请求延迟
+func (s *ewmaStats) observe(rtt float64, now time.Time, decay time.Duration) {
+	if rtt > s.cost {
+		s.cost = rtt
+	} else {
+		w := s.weight(now, decay)
+		s.cost = s.cost*w + rtt*(1-w)
+	}
+	s.stamp = now
+}
+
+// decayedCost 长时间没有新数据时延迟统计逐渐衰减，让曾经变慢的节点重新获得流量
+func (s *ewmaStats) decayedCost(now time.Time, decay time.Duration) float64 {
+	return s.cost * s.weight(now, decay)
+}
+
+func (s *ewmaStats) weight(now time.Time, decay time.Duration) float64 {
+	elapsed := now.Sub(s.stamp)
+	if elapsed <= 0 {
+		return 1
+	}
+	return math.Exp(-float64(elapsed) / float64(decay))
+}
+
+// NewP2C 两次随机选择（Power of Two Choices），比较延迟 EWMA 与在途请求数的乘积，decay 为延迟统计的衰减时间，0 表示使用 DefaultDecay
+func NewP2C(decay time.Duration) LoadBalancer {
+	if decay <= 0 {
+		decay = DefaultDecay
+	}
+	return New(func() Balancer {
+		return &p2c{
+			r:     rand.New(rand.NewSource(time.Now().UnixNano())),
+			decay: decay,
+			now:   time.Now,
+			stats: make(map[string]*ewmaStats),
+		}
+	})
+}
@@ -0,0 +1,134 @@
+package loadbalancer
+
+import (
+	"context"
+	"github.com/stretchr/testify/assert"
+	"github.com/xialeistudio/go-service-discovery/discovery"
+	"math/rand"
+	"net"
+	"testing"
+	"time"
+)
+
+func Test_p2c_Select(t *testing.T) {
+	a := assert.New(t)
+	now := time.Unix(0, 0)
+	lb := &p2c{
+		r:     rand.New(rand.NewSource(1)),
+		decay: 10 * time.Second,
+		now:   func() time.Time { return now },
+		stats: make(map[string]*ewmaStats),
+	}
+	nodes := []*discovery.ServiceNode{
+		{
+			ServiceName: "test",
+			IP:          net.IPv4(127, 0, 0, 1),
+			Port:        8484,
+			Tags:        map[string]string{},
+		},
+		{
+			ServiceName: "test",
+			IP:          net.IPv4(127, 0, 0, 2),
+			Port:        8484,
+			Tags:        map[string]string{},
+		},
+	}
+
+	// 新节点在首个响应返回前不会被重复选中
+	first, done1 := lb.Select(context.Background(), nodes)
+	second, done2 := lb.Select(context.Background(), nodes)
+	a.NotEqual(first, second)
+	slow, fast := nodes[0], nodes[1]
+	if first == slow {
+		done1(DoneInfo{Latency: 105 * time.Millisecond})
+		done2(DoneInfo{Latency: 10 * time.Millisecond})
+	} else {
+		done1(DoneInfo{Latency: 10 * time.Millisecond})
+		done2(DoneInfo{Latency: 105 * time.Millisecond})
+	}
+
+	// 优先选择延迟低的节点
+	for i := 0; i < 5; i++ {
+		node, done := lb.Select(context.Background(), nodes)
+		a.Equal(fast, node)
+		done(DoneInfo{Latency: 10 * time.Millisecond})
+	}
+
+	// 快节点在途请求过多时选择慢节点
+	var dones []DoneFunc
+	for i := 0; i < 10; i++ {
+		node, done := lb.Select(context.Background(), nodes)
+		a.Equal(fast, node)
+		dones = append(dones, done)
+	}
+	node, done := lb.Select(context.Background(), nodes)
+	a.Equal(slow, node)
+	done(DoneInfo{Latency: 105 * time.Millisecond})
+	for _, done := range dones {
+		done(DoneInfo{Latency: 10 * time.Millisecond})
+	}
+
+	// 慢节点长时间没有数据后统计衰减，重新获得流量
+	now = now.Add(time.Minute)
+	lb.stats[fast.Address()].stamp = now
+	node, _ = lb.Select(context.Background(), nodes)
+	a.Equal(slow, node)
+}
+
+func Test_p2c_Select_warming(t *testing.T) {
+	a := assert.New(t)
+	now := time.Unix(0, 0)
+	lb := &p2c{
+		r:     rand.New(rand.NewSource(1)),
+		decay: 10 * time.Second,
+		now:   func() time.Time { return now },
+		stats: make(map[string]*ewmaStats),
+	}
+	nodes := newHashTestNodes(2)
+	lb.stats[nodes[0].Address()] = &ewmaStats{stamp: now, inflight: 100}
+	lb.stats[nodes[1].Address()] = &ewmaStats{stamp: now, inflight: 1}
+
+	// 都没有延迟数据时选择在途请求少的节点
+	a.Less(lb.score(nodes[1], now), lb.score(nodes[0], now))
+	for i := 0; i < 5; i++ {
+		node, done := lb.Select(context.Background(), nodes)
+		a.Equal(nodes[1], node)
+		done(DoneInfo{Err: context.Canceled})
+	}
+}
+
+func Test_p2c_Select_prune(t *testing.T) {
+	a := assert.New(t)
+	now := time.Unix(0, 0)
+	lb := &p2c{
+		r:     rand.New(rand.NewSource(1)),
+		decay: 10 * time.Second,
+		now:   func() time.Time { return now },
+		stats: make(map[string]*ewmaStats),
+	}
+	nodes := []*discovery.ServiceNode{
+		{
+			ServiceName: "test",
+			IP:          net.IPv4(127, 0, 0, 1),
+			Port:        8484,
+			Tags:        map[string]string{},
+		},
+		{
+			ServiceName: "test",
+			IP:          net.IPv4(127, 0, 0, 2),
+			Port:        8484,
+			Tags:        map[string]string{},
+		},
+	}
+	for i := 0; i < 4; i++ {
+		_, done := lb.Select(context.Background(), nodes)
+		done(DoneInfo{Latency: time.Millisecond})
+	}
+	a.Len(lb.stats, 2)
+
+	// 节点下线一个衰减周期后统计数据被清理
+	now = now.Add(time.Minute)
+	node, _ := lb.Select(context.Background(), nodes[:1])
+	a.Equal(nodes[0], node)
+	a.Len(lb.stats, 1)
+}
@@ -0,0 +1,103 @@
+package loadbalancer
+
+import (
+	"context"
+	"github.com/spf13/cast"
+	"github.com/xialeistudio/go-service-discovery/discovery"
+	"math/rand"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// PriorityConfig 优先级负载均衡配置
+type PriorityConfig struct {
+	// PriorityTag 节点优先级的标签名，默认为 priority，值越小优先级越高，0 为主集群，缺失或不合法时为 0
+	PriorityTag string
+	// MinNodes 每个优先级的节点数不少于该值时视为健康，默认为 1
+	// 不足时该优先级只承担 节点数/MinNodes 比例的流量，剩余流量依次转移到下一优先级
+	MinNodes int
+}
+
+type priority struct {
+	inner  LoadBalancer
+	config PriorityConfig
+	mu     sync.Mutex
+	r      *rand.Rand
+}
+
+func (p *priority) Select(ctx context.Context, serviceName string, nodes []*discovery.ServiceNode) (*discovery.ServiceNode, DoneFunc) {
+	if len(nodes) == 0 {
+		return nil, noopDone
+	}
+
+	// 按优先级分组
+	tiers := make(map[int][]*discovery.ServiceNode)
+	for _, node := range nodes {
+		level, err := cast.ToIntE(node.Tags[p.config.PriorityTag])
+		if err != nil || level < 0 {
+			level = 0
+		}
+		tiers[level] = append(tiers[level], node)
+	}
+	levels := make([]int, 0, len(tiers))
+	for level := range tiers {
+		levels = append(levels, level)
+	}
+	sort.Ints(levels)
+
+	level := p.pick(levels, tiers)
+	// 各优先级使用不同的 key，互不影响内部策略的状态
+	key := serviceName
+	if level != 0 {
+		key = serviceName + "#priority-" + strconv.Itoa(level)
+	}
+	return p.inner.Select(ctx, key, tiers[level])
+}
+
+// pick 按健康度为各优先级分配流量，高优先级健康度为 h 时承担 h 的流量，剩余流量交给下一优先级
+func (p *priority) pick(levels []int, tiers map[int][]*discovery.ServiceNode) int {
+	if len(levels) == 1 {
+		return levels[0]
+	}
+	loads := make([]float64, len(levels))
+	remaining := 1.0
+	for i, level := range levels {
+		health := float64(len(tiers[level])) / float64(p.config.MinNodes)
+		if health > 1 {
+			health = 1
+		}
+		loads[i] = remaining * health
+		remaining -= loads[i]
+	}
+	// 所有优先级都不健康时，剩余流量按已分配的比例归一化
+	total := 1 - remaining
+
+	p.mu.Lock()
+	value := p.r.Float64() * total
+	p.mu.Unlock()
+	for i, load := range loads {
+		if value < load {
+			return levels[i]
+		}
+		value -= load
+	}
+	return levels[len(levels)-1]
+}
+
+// NewPriority 优先级负载均衡，只向节点数足够的最高优先级发送流量，不足时逐步转移到低优先级，恢复后自动切回
+// 节点的选择委托给 inner
+func NewPriority(inner LoadBalancer, config PriorityConfig) LoadBalancer {
+	if config.PriorityTag == "" {
+		config.PriorityTag = "priority"
+	}
+	if config.MinNodes <= 0 {
+		config.MinNodes = 1
+	}
+	return &priority{
+		inner:  inner,
+		config: config,
+		r:      rand.New(rand.NewSource(time.Now().UnixNano())),
+	}
+}
@@ -0,0 +1,60 @@
+package loadbalancer
+
+import (
+	"github.com/stretchr/testify/assert"
+	"math/rand"
+	"testing"
+)
+
+func Test_priority_Select(t *testing.T) {
+	a := assert.New(t)
+	lb := &priority{
+		inner: NewRoundRobin(),
+		config: PriorityConfig{
+			PriorityTag: "priority",
+			MinNodes:    4,
+		},
+		r: rand.New(rand.NewSource(1)),
+	}
+
+	// 主集群健康时流量全部发往主集群
+	nodes := newTagTestNodes("priority", "0", "0", "0", "0", "1", "1", "1", "1", "2")
+	a.Equal(map[string]int{"0": 100}, countTags(lb, nodes, "priority", 100))
+
+	// 主集群只剩一半节点时一半流量转移到备用集群
+	nodes = newTagTestNodes("priority", "0", "0", "1", "1", "1", "1", "2")
+	counts := countTags(lb, nodes, "priority", 10000)
+	a.InDelta(5000, counts["0"], 300)
+	a.InDelta(5000, counts["1"], 300)
+	a.Zero(counts["2"])
+
+	// 主集群和一级备用集群都不足时逐级转移
+	nodes = newTagTestNodes("priority", "0", "0", "1", "1", "2", "2", "2", "2")
+	counts = countTags(lb, nodes, "priority", 10000)
+	a.InDelta(5000, counts["0"], 300)
+	a.InDelta(2500, counts["1"], 300)
+	a.InDelta(2500, counts["2"], 300)
+
+	// 所有优先级都不健康时按健康度归一化
+	nodes = newTagTestNodes("priority", "0", "1", "1")
+	counts = countTags(lb, nodes, "priority", 10000)
+	a.InDelta(10000*0.25/0.625, counts["0"], 300)
+	a.InDelta(10000*0.375/0.625, counts["1"], 300)
+
+	// 主集群没有节点时全部转移
+	nodes = newTagTestNodes("priority", "1", "1", "1", "1", "2")
+	a.Equal(map[string]int{"1": 100}, countTags(lb, nodes, "priority", 100))
+}
+
+func Test_NewPriority(t *testing.T) {
+	a := assert.New(t)
+	lb := NewPriority(NewRoundRobin(), PriorityConfig{})
+
+	// 缺失的优先级视为主集群，主集群恢复后切回
+	nodes := newTagTestNodes("priority", "", "1")
+	a.Equal(map[string]int{"": 10}, countTags(lb, nodes, "priority", 10))
+	nodes = newTagTestNodes("priority", "1")
+	a.Equal(map[string]int{"1": 10}, countTags(lb, nodes, "priority", 10))
+	nodes = newTagTestNodes("priority", "0", "1")
+	a.Equal(map[string]int{"0": 10}, countTags(lb, nodes, "priority", 10))
+}
@@ -1,25 +1,32 @@
 package loadbalancer
 
 import (
+	"context"
 	"github.com/xialeistudio/go-service-discovery/discovery"
 	"math/rand"
+	"sync"
 	"time"
 )
 
 type random struct {
-	r *rand.Rand
+	mu sync.Mutex
+	r  *rand.Rand
 }
 
-func (r random) Select(nodes []*discovery.ServiceNode) *discovery.ServiceNode {
+func (r *random) Select(_ context.Context, nodes []*discovery.ServiceNode) (*discovery.ServiceNode, DoneFunc) {
 	if len(nodes) == 0 {
-		return nil
+		return nil, noopDone
 	}
+	r.mu.Lock()
 	index := r.r.Intn(len(nodes))
-	return nodes[index]
+	r.mu.Unlock()
+	return nodes[index], noopDone
 }
 
 func NewRandom() LoadBalancer {
-	return &random{
-		r: rand.New(rand.NewSource(time.Now().Unix())),
-	}
+	return New(func() Balancer {
+		return &random{
+			r: rand.New(rand.NewSource(time.Now().UnixNano())),
+		}
+	})
 }
@@ -1,6 +1,7 @@
 package loadbalancer
 
 import (
+	"context"
 	"github.com/stretchr/testify/assert"
 	"github.com/xialeistudio/go-service-discovery/discovery"
 	"math/rand"
@@ -33,12 +34,12 @@ func Test_random_Select(t *testing.T) {
 		},
 	}
 
-	node := lb.Select(nodes)
+	node, _ := lb.Select(context.Background(), nodes)
 	a.Equal(nodes[2], node)
 
-	node = lb.Select(nodes)
+	node, _ = lb.Select(context.Background(), nodes)
 	a.Equal(nodes[0], node)
 
-	node = lb.Select(nodes)
+	node, _ = lb.Select(context.Background(), nodes)
 	a.Equal(nodes[2], node)
 }
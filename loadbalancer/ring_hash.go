@@ -0,0 +1,102 @@
+package loadbalancer
+
+import (
+	"context"
+	"github.com/xialeistudio/go-service-discovery/discovery"
+	"math/rand"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// DefaultReplicas 一致性哈希环上每个节点的平均虚拟节点数
+var DefaultReplicas = 160
+
+type ringEntry struct {
+	hash uint64
+	node *discovery.ServiceNode
+}
+
+type ringHash struct {
+	mu       sync.Mutex
+	r        *rand.Rand
+	replicas int
+	members  nodeSet
+	ring     []ringEntry // 按 hash 升序
+}
+
+func (h *ringHash) Select(ctx context.Context, nodes []*discovery.ServiceNode) (*discovery.ServiceNode, DoneFunc) {
+	if len(nodes) == 0 {
+		return nil, noopDone
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	// 节点变动时重建哈希环
+	if !h.members.equal(nodes) {
+		h.members = newNodeSet(nodes)
+		h.ring = buildRing(nodes, h.replicas)
+	}
+
+	key, ok := HashKeyFromContext(ctx)
+	if !ok {
+		// 没有哈希键时随机选择
+		return nodes[h.r.Intn(len(nodes))], noopDone
+	}
+	hash := hashString(key)
+	index := sort.Search(len(h.ring), func(i int) bool {
+		return h.ring[i].hash >= hash
+	})
+	if index == len(h.ring) {
+		index = 0
+	}
+	return h.ring[index].node, noopDone
+}
+
+// buildRing 按权重分配虚拟节点，虚拟节点总数为 replicas*len(nodes)，每个节点至少一个
+func buildRing(nodes []*discovery.ServiceNode, replicas int) []ringEntry {
+	totalWeight := 0
+	for _, node := range nodes {
+		totalWeight += nodeWeight(node)
+	}
+	total := float64(replicas * len(nodes))
+
+	var ring []ringEntry
+	for _, node := range nodes {
+		count := int(total*float64(nodeWeight(node))/float64(totalWeight) + 0.5)
+		if count < 1 {
+			count = 1
+		}
+		address := node.Address()
+		for i := 0; i < count; i++ {
+			ring = append(ring, ringEntry{
+				hash: hashString(address + "#" + strconv.Itoa(i)),
+				node: node,
+			})
+		}
+	}
+	sort.Slice(ring, func(i, j int) bool {
+		// hash 相同时按地址排序，保证不同客户端构建出相同的环
+		if ring[i].hash == ring[j].hash {
+			return ring[i].node.Address() < ring[j].node.Address()
+		}
+		return ring[i].hash < ring[j].hash
+	})
+	return ring
+}
+
+// NewRingHash 一致性哈希，通过 WithHashKey 传入请求的哈希键，节点增减时只有约 1/N 的键会迁移
+// replicas 为每个节点的平均虚拟节点数，按 weight 标签分配，0 表示使用 DefaultReplicas
+func NewRingHash(replicas int) LoadBalancer {
+	if replicas <= 0 {
+		replicas = DefaultReplicas
+	}
+	return New(func() Balancer {
+		return &ringHash{
+			r:        rand.New(rand.NewSource(time.Now().UnixNano())),
+			replicas: replicas,
+		}
+	})
+}
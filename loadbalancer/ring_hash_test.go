@@ -0,0 +1,96 @@
+package loadbalancer
+
+import (
+	"context"
+	"github.com/stretchr/testify/assert"
+	"github.com/xialeistudio/go-service-discovery/discovery"
+	"math/rand"
+	"net"
+	"strconv"
+	"testing"
+)
+
+func newHashTestNodes(count int) []*discovery.ServiceNode {
+	nodes := make([]*discovery.ServiceNode, count)
+	for i := range nodes {
+		nodes[i] = &discovery.ServiceNode{
+			ServiceName: "test",
+			IP:          net.IPv4(127, 0, 0, byte(i+1)),
+			Port:        8484,
+			Tags:        map[string]string{},
+		}
+	}
+	return nodes
+}
+
+func selectByKey(lb Balancer, nodes []*discovery.ServiceNode, key string) *discovery.ServiceNode {
+	node, _ := lb.Select(WithHashKey(context.Background(), key), nodes)
+	return node
+}
+
+func Test_ringHash_Select(t *testing.T) {
+	a := assert.New(t)
+	lb := &ringHash{r: rand.New(rand.NewSource(1)), replicas: DefaultReplicas}
+	nodes := newHashTestNodes(4)
+
+	// 相同的键总是选中相同的节点，与节点顺序无关
+	node := selectByKey(lb, nodes, "user-1")
+	a.Equal(node, selectByKey(lb, nodes, "user-1"))
+	reversed := []*discovery.ServiceNode{nodes[3], nodes[2], nodes[1], nodes[0]}
+	a.Equal(node, selectByKey(lb, reversed, "user-1"))
+	// 不同实例构建出相同的环
+	other := &ringHash{r: rand.New(rand.NewSource(2)), replicas: DefaultReplicas}
+	a.Equal(node, selectByKey(other, nodes, "user-1"))
+
+	// 没有哈希键时随机选择
+	node, _ = lb.Select(context.Background(), nodes)
+	a.NotNil(node)
+}
+
+func Test_ringHash_Select_membership(t *testing.T) {
+	a := assert.New(t)
+	lb := &ringHash{r: rand.New(rand.NewSource(1)), replicas: DefaultReplicas}
+	nodes := newHashTestNodes(5)
+
+	const keys = 10000
+	before := make([]*discovery.ServiceNode, keys)
+	for i := range before {
+		before[i] = selectByKey(lb, nodes[:4], "key-"+strconv.Itoa(i))
+	}
+
+	// 新增节点时只有迁移到新节点的键发生变化，约占 1/5
+	moved := 0
+	for i := range before {
+		node := selectByKey(lb, nodes, "key-"+strconv.Itoa(i))
+		if node != before[i] {
+			a.Equal(nodes[4], node)
+			moved++
+		}
+	}
+	a.InDelta(0.2, float64(moved)/keys, 0.05)
+
+	// 删除节点时只有该节点上的键发生变化
+	for i := range before {
+		node := selectByKey(lb, nodes[1:4], "key-"+strconv.Itoa(i))
+		if before[i] != nodes[0] {
+			a.Equal(before[i], node)
+		}
+	}
+}
+
+func Test_ringHash_Select_weighted(t *testing.T) {
+	a := assert.New(t)
+	lb := &ringHash{r: rand.New(rand.NewSource(1)), replicas: DefaultReplicas}
+	nodes := newHashTestNodes(2)
+	nodes[0].Tags["weight"] = "3"
+	nodes[1].Tags["weight"] = "1"
+
+	const keys = 10000
+	count := 0
+	for i := 0; i < keys; i++ {
+		if selectByKey(lb, nodes, "key-"+strconv.Itoa(i)) == nodes[0] {
+			count++
+		}
+	}
+	a.InDelta(0.75, float64(count)/keys, 0.05)
+}
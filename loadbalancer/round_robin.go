@@ -1,22 +1,32 @@
 package loadbalancer
 
 import (
+	"context"
 	"github.com/xialeistudio/go-service-discovery/discovery"
+	"sync"
 )
 
 type roundRobin struct {
+	mu    sync.Mutex
 	index int
 }
 
-func (r *roundRobin) Select(nodes []*discovery.ServiceNode) *discovery.ServiceNode {
+func (r *roundRobin) Select(_ context.Context, nodes []*discovery.ServiceNode) (*discovery.ServiceNode, DoneFunc) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
 	if len(nodes) == 0 {
-		return nil
+		return nil, noopDone
 	}
+	// 节点减少时 index 可能越界
+	r.index %= len(nodes)
 	node := nodes[r.index]
 	r.index = (r.index + 1) % len(nodes)
-	return node
+	return node, noopDone
 }
 
 func NewRoundRobin() LoadBalancer {
-	return &roundRobin{}
+	return New(func() Balancer {
+		return &roundRobin{}
+	})
 }
@@ -1,6 +1,7 @@
 package loadbalancer
 
 import (
+	"context"
 	"github.com/stretchr/testify/assert"
 	"github.com/xialeistudio/go-service-discovery/discovery"
 	"net"
@@ -31,9 +32,43 @@ func Test_roundRobin_Select(t *testing.T) {
 	}
 
 	lb := NewRoundRobin()
-	node := lb.Select(nodes)
+	node, _ := lb.Select(context.Background(), "test", nodes)
 	a.Equal(nodes[0], node)
 
-	node = lb.Select(nodes)
+	node, _ = lb.Select(context.Background(), "test", nodes)
 	a.Equal(nodes[1], node)
 }
+
+func Test_roundRobin_Select_isolated(t *testing.T) {
+	a := assert.New(t)
+	nodes := []*discovery.ServiceNode{
+		{
+			ServiceName: "test",
+			IP:          net.IPv4(127, 0, 0, 1),
+			Port:        8484,
+			Tags:        map[string]string{},
+		},
+		{
+			ServiceName: "test",
+			IP:          net.IPv4(127, 0, 0, 2),
+			Port:        8484,
+			Tags:        map[string]string{},
+		},
+	}
+
+	lb := NewRoundRobin()
+	node, _ := lb.Select(context.Background(), "a", nodes)
+	a.Equal(nodes[0], node)
+	// 服务 b 的状态不受服务 a 影响
+	node, _ = lb.Select(context.Background(), "b", nodes)
+	a.Equal(nodes[0], node)
+	node, _ = lb.Select(context.Background(), "a", nodes)
+	a.Equal(nodes[1], node)
+	node, _ = lb.Select(context.Background(), "b", nodes)
+	a.Equal(nodes[1], node)
+	node, _ = lb.Select(context.Background(), "b", nodes)
+	a.Equal(nodes[0], node)
+	// 节点减少时不越界
+	node, _ = lb.Select(context.Background(), "b", nodes[:1])
+	a.Equal(nodes[0], node)
+}
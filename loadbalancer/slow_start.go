@@ -0,0 +1,165 @@
+package loadbalancer
+
+import (
+	"context"
+	"github.com/xialeistudio/go-service-discovery/discovery"
+	"math/rand"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// SlowStartConfig 慢启动配置
+type SlowStartConfig struct {
+	// Window 预热时长，默认 30 秒
+	Window time.Duration
+	// MinFraction 预热开始时节点获得的流量比例，之后线性增加到 1，默认 0.1
+	MinFraction float64
+	// RegisteredAtTag 节点注册时间的标签名，值为 unix 秒或 RFC3339 时间，默认为 registered_at
+	// 节点没有该标签时从客户端首次发现节点开始计时
+	RegisteredAtTag string
+}
+
+type slowStartNode struct {
+	firstSeen time.Time
+	lastSeen  time.Time
+}
+
+type slowStartService struct {
+	mu          sync.Mutex
+	initialized bool                      // 是否已完成首次选择
+	nodes       map[string]*slowStartNode // <ip:port>
+	lastPrune   time.Time
+}
+
+type slowStart struct {
+	inner    LoadBalancer
+	config   SlowStartConfig
+	now      func() time.Time
+	services sync.Map // <serviceName, *slowStartService>
+	mu       sync.Mutex
+	r        *rand.Rand
+}
+
+func (s *slowStart) Select(ctx context.Context, serviceName string, nodes []*discovery.ServiceNode) (*discovery.ServiceNode, DoneFunc) {
+	value, exists := s.services.Load(serviceName)
+	if !exists {
+		value, _ = s.services.LoadOrStore(serviceName, &slowStartService{nodes: make(map[string]*slowStartNode)})
+	}
+	service := value.(*slowStartService)
+	now := s.now()
+
+	// 记录节点的发现时间
+	service.mu.Lock()
+	// 在锁内判断是否首次选择，并发的首次请求中只有最先拿到锁的一个按首次选择处理
+	initial := !service.initialized
+	service.initialized = true
+	fractions := make(map[*discovery.ServiceNode]float64)
+	for _, node := range nodes {
+		key := node.Address()
+		state := service.nodes[key]
+		if state == nil {
+			state = &slowStartNode{firstSeen: now}
+			if initial {
+				// 首次选择时已存在的节点视为预热完毕，避免客户端启动时所有节点同时进入慢启动
+				state.firstSeen = time.Time{}
+			}
+			service.nodes[key] = state
+		}
+		state.lastSeen = now
+		if fraction := s.fraction(node, state, now); fraction < 1 {
+			fractions[node] = fraction
+		}
+	}
+	s.prune(service, now)
+	service.mu.Unlock()
+
+	candidates, key := nodes, serviceName
+	for {
+		node, done := s.inner.Select(ctx, key, candidates)
+		fraction, warming := fractions[node]
+		// 预热中的节点按 fraction 的概率接受，实际获得的流量约为完全预热时的 fraction 倍
+		if !warming || len(candidates) == 1 || s.hit(fraction) {
+			return node, done
+		}
+		// 放弃本次选择，在其余节点中重新选择，重新选择使用独立的 key，不影响内部策略的主状态
+		done(DoneInfo{Err: context.Canceled})
+		candidates = excludeNode(candidates, node)
+		key = serviceName + "#slow-start"
+	}
+}
+
+// fraction 节点当前应获得的流量比例
+func (s *slowStart) fraction(node *discovery.ServiceNode, state *slowStartNode, now time.Time) float64 {
+	start := state.firstSeen
+	if registeredAt, ok := parseTime(node.Tags[s.config.RegisteredAtTag]); ok {
+		start = registeredAt
+	}
+	elapsed := now.Sub(start)
+	if elapsed >= s.config.Window {
+		return 1
+	}
+	if elapsed <= 0 {
+		return s.config.MinFraction
+	}
+	return s.config.MinFraction + (1-s.config.MinFraction)*float64(elapsed)/float64(s.config.Window)
+}
+
+func (s *slowStart) hit(fraction float64) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.r.Float64() < fraction
+}
+
+// prune 每个预热周期清理一次长时间未出现的节点，节点重新上线时再次慢启动
+func (s *slowStart) prune(service *slowStartService, now time.Time) {
+	if now.Sub(service.lastPrune) < s.config.Window {
+		return
+	}
+	service.lastPrune = now
+	for key, state := range service.nodes {
+		if now.Sub(state.lastSeen) >= s.config.Window {
+			delete(service.nodes, key)
+		}
+	}
+}
+
+func excludeNode(nodes []*discovery.ServiceNode, excluded *discovery.ServiceNode) []*discovery.ServiceNode {
+	result := make([]*discovery.ServiceNode, 0, len(nodes)-1)
+	for _, node := range nodes {
+		if node != excluded {
+			result = append(result, node)
+		}
+	}
+	return result
+}
+
+func parseTime(value string) (time.Time, bool) {
+	if value == "" {
+		return time.Time{}, false
+	}
+	if seconds, err := strconv.ParseInt(value, 10, 64); err == nil {
+		return time.Unix(seconds, 0), true
+	}
+	t, err := time.Parse(time.RFC3339, value)
+	return t, err == nil
+}
+
+// NewSlowStart 慢启动，新节点的流量在预热时长内从 MinFraction 线性增加到完全比例，节点的选择委托给 inner
+func NewSlowStart(inner LoadBalancer, config SlowStartConfig) LoadBalancer {
+	if config.Window <= 0 {
+		config.Window = 30 * time.Second
+	}
+	if config.MinFraction <= 0 || config.MinFraction > 1 {
+		config.MinFraction = 0.1
+	}
+	if config.RegisteredAtTag == "" {
+		config.RegisteredAtTag = "registered_at"
+	}
+	return &slowStart{
+		inner:  inner,
+		config: config,
+		now:    time.Now,
+		r:      rand.New(rand.NewSource(time.Now().UnixNano())),
+	}
+}
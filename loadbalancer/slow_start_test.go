@@ -0,0 +1,145 @@
+package loadbalancer
+
+import (
+	"context"
+	"github.com/stretchr/testify/assert"
+	"math/rand"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+)
+
+func Test_slowStart_Select(t *testing.T) {
+	a := assert.New(t)
+	now := time.Unix(1000, 0)
+	lb := &slowStart{
+		inner: NewRoundRobin(),
+		config: SlowStartConfig{
+			Window:          10 * time.Second,
+			MinFraction:     0.1,
+			RegisteredAtTag: "registered_at",
+		},
+		now: func() time.Time { return now },
+		r:   rand.New(rand.NewSource(1)),
+	}
+	nodes := newTagTestNodes("id", "0", "1", "2")
+
+	// 首次选择时已存在的节点不需要预热
+	counts := countTags(lb, nodes[:2], "id", 100)
+	a.Equal(50, counts["0"])
+	a.Equal(50, counts["1"])
+
+	// 新节点开始时只获得少量流量
+	counts = countTags(lb, nodes, "id", 9000)
+	a.InDelta(3000*0.1, counts["2"], 100)
+	a.InDelta(4500-3000*0.1/2, counts["0"], 200)
+
+	// 预热过半
+	now = now.Add(5 * time.Second)
+	counts = countTags(lb, nodes, "id", 9000)
+	a.InDelta(3000*0.55, counts["2"], 150)
+
+	// 预热完成后获得完全比例的流量
+	now = now.Add(5 * time.Second)
+	counts = countTags(lb, nodes, "id", 300)
+	a.Equal(100, counts["2"])
+}
+
+func Test_slowStart_Select_concurrent(t *testing.T) {
+	a := assert.New(t)
+	lb := NewSlowStart(NewRoundRobin(), SlowStartConfig{Window: time.Minute}).(*slowStart)
+	nodes := newHashTestNodes(3)
+
+	// 首个请求创建服务状态后暂停，第二个请求先拿到锁
+	var mu sync.Mutex
+	calls := 0
+	paused, resume := make(chan struct{}), make(chan struct{})
+	lb.now = func() time.Time {
+		mu.Lock()
+		calls++
+		first := calls == 1
+		mu.Unlock()
+		if first {
+			close(paused)
+			<-resume
+		}
+		return time.Unix(1000, 0)
+	}
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		_, done := lb.Select(context.Background(), "test", nodes)
+		done(DoneInfo{})
+	}()
+	<-paused
+	_, done := lb.Select(context.Background(), "test", nodes)
+	done(DoneInfo{})
+	close(resume)
+	wg.Wait()
+
+	// 并发的首次请求不会让已存在的节点进入慢启动
+	value, _ := lb.services.Load("test")
+	for _, state := range value.(*slowStartService).nodes {
+		a.True(state.firstSeen.IsZero())
+	}
+}
+
+func Test_slowStart_Select_registeredAt(t *testing.T) {
+	a := assert.New(t)
+	now := time.Unix(1000, 0)
+	lb := &slowStart{
+		inner: NewRoundRobin(),
+		config: SlowStartConfig{
+			Window:          10 * time.Second,
+			MinFraction:     0.1,
+			RegisteredAtTag: "registered_at",
+		},
+		now: func() time.Time { return now },
+		r:   rand.New(rand.NewSource(1)),
+	}
+	nodes := newTagTestNodes("id", "0", "1")
+	// 按节点注册时间计算预热进度，即使是首次选择
+	nodes[1].Tags["registered_at"] = strconv.FormatInt(now.Add(-5*time.Second).Unix(), 10)
+
+	counts := countTags(lb, nodes, "id", 10000)
+	a.InDelta(5000*0.55, counts["1"], 200)
+
+	// RFC3339 格式
+	nodes[1].Tags["registered_at"] = now.Add(-time.Minute).Format(time.RFC3339)
+	counts = countTags(lb, nodes, "id", 100)
+	a.Equal(50, counts["1"])
+}
+
+func Test_slowStart_Select_prune(t *testing.T) {
+	a := assert.New(t)
+	now := time.Unix(1000, 0)
+	lb := NewSlowStart(NewRoundRobin(), SlowStartConfig{Window: 10 * time.Second}).(*slowStart)
+	lb.now = func() time.Time { return now }
+	nodes := newTagTestNodes("id", "0", "1")
+
+	countTags(lb, nodes, "id", 10)
+	value, _ := lb.services.Load("test")
+	a.Len(value.(*slowStartService).nodes, 2)
+
+	// 节点下线超过一个预热周期后清理，重新上线时再次慢启动
+	now = now.Add(time.Minute)
+	countTags(lb, nodes[:1], "id", 10)
+	a.Len(value.(*slowStartService).nodes, 1)
+	now = now.Add(time.Second)
+	counts := countTags(lb, nodes, "id", 10000)
+	a.Less(counts["1"], 1000)
+}
+
+func Test_slowStart_Select_allWarming(t *testing.T) {
+	a := assert.New(t)
+	lb := NewSlowStart(NewRoundRobin(), SlowStartConfig{Window: time.Minute})
+	nodes := newTagTestNodes("id", "0", "1")
+	_, done := lb.Select(context.Background(), "test", nil)
+	done(DoneInfo{})
+
+	// 所有节点都在预热时仍然能选出节点
+	counts := countTags(lb, nodes, "id", 100)
+	a.Equal(100, counts["0"]+counts["1"])
+}
@@ -1,85 +1,62 @@
 package loadbalancer
 
 import (
-	"github.com/spf13/cast"
+	"context"
 	"github.com/xialeistudio/go-service-discovery/discovery"
 	"sync"
 )
 
+// weightedRoundRobin 平滑加权轮询（nginx），每次所有节点的当前权重加上各自权重，选中当前权重最大的节点后减去总权重
 type weightedRoundRobin struct {
-	mu            sync.Mutex
-	index         int
-	currentWeight int
-	totalWeight   int
-	nodes         []*discovery.ServiceNode
+	mu      sync.Mutex
+	members nodeSet
+	current map[string]int // <ip:port, 当前权重>
 }
 
-func (w *weightedRoundRobin) Select(nodes []*discovery.ServiceNode) *discovery.ServiceNode {
+func (w *weightedRoundRobin) Select(_ context.Context, nodes []*discovery.ServiceNode) (*discovery.ServiceNode, DoneFunc) {
 	w.mu.Lock()
 	defer w.mu.Unlock()
 
 	if len(nodes) == 0 {
-		return nil
+		return nil, noopDone
 	}
 
-	// 节点变动时重新计算权重
-	if !equalNodes(w.nodes, nodes) {
-		w.nodes = nodes
-		w.totalWeight = 0
+	// 节点变动时只清理已下线的节点，其余节点保留当前权重
+	if !w.members.equal(nodes) {
+		w.members = newNodeSet(nodes)
+		alive := make(map[string]struct{}, len(nodes))
 		for _, node := range nodes {
-			w.totalWeight += cast.ToInt(node.Tags["weight"])
+			alive[node.Address()] = struct{}{}
 		}
-	}
-
-	for {
-		w.index = (w.index + 1) % len(nodes)
-		if w.index == 0 {
-			w.currentWeight -= gcd(nodes)
-			if w.currentWeight <= 0 {
-				w.currentWeight = w.totalWeight
-				if w.currentWeight == 0 {
-					return nil
-				}
+		for key := range w.current {
+			if _, exists := alive[key]; !exists {
+				delete(w.current, key)
 			}
 		}
-
-		if cast.ToInt(nodes[w.index].Tags["weight"]) >= w.currentWeight {
-			return nodes[w.index]
-		}
-	}
-}
-
-func equalNodes(a, b []*discovery.ServiceNode) bool {
-	if len(a) != len(b) {
-		return false
-	}
-	for i := range a {
-		if a[i] != b[i] {
-			return false
-		}
 	}
-	return true
-}
 
-func gcd(nodes []*discovery.ServiceNode) int {
-	gcdValue := cast.ToInt(nodes[0].Tags["weight"])
+	var (
+		selected    *discovery.ServiceNode
+		selectedKey string
+		totalWeight int
+	)
 	for _, node := range nodes {
-		gcdValue = gcdTwo(gcdValue, cast.ToInt(node.Tags["weight"]))
-	}
-	return gcdValue
-}
-
-func gcdTwo(a, b int) int {
-	if b == 0 {
-		return a
+		key := node.Address()
+		weight := nodeWeight(node)
+		w.current[key] += weight
+		totalWeight += weight
+		if selected == nil || w.current[key] > w.current[selectedKey] {
+			selected, selectedKey = node, key
+		}
 	}
-	return gcdTwo(b, a%b)
+	w.current[selectedKey] -= totalWeight
+	return selected, noopDone
 }
 
 func NewWeightedRoundRobin() LoadBalancer {
-	return &weightedRoundRobin{
-		index:         -1,
-		currentWeight: 0,
-		totalWeight:   0,
-	}
+	return New(func() Balancer {
+		return &weightedRoundRobin{
+			current: make(map[string]int),
+		}
+	})
 }
@@ -1,6 +1,7 @@
 package loadbalancer
 
 import (
+	"context"
 	"github.com/stretchr/testify/assert"
 	"github.com/xialeistudio/go-service-discovery/discovery"
 	"net"
@@ -37,12 +38,114 @@ func Test_weightedRoundRobin_Select(t *testing.T) {
 	}
 
 	lb := NewWeightedRoundRobin()
-	node := lb.Select(nodes)
+	node, _ := lb.Select(context.Background(), "test", nodes)
 	a.Equal(nodes[0], node)
 
-	node = lb.Select(nodes)
+	node, _ = lb.Select(context.Background(), "test", nodes)
+	a.Equal(nodes[2], node)
+
+	node, _ = lb.Select(context.Background(), "test", nodes)
+	a.Equal(nodes[1], node)
+
+	// 一个周期内按权重分配，且同一节点最多连续被选中两次
+	counts := make(map[*discovery.ServiceNode]int)
+	last, run := node, 1
+	for i := 0; i < 220-3; i++ {
+		node, _ = lb.Select(context.Background(), "test", nodes)
+		counts[node]++
+		if node == last {
+			run++
+		} else {
+			last, run = node, 1
+		}
+		a.LessOrEqual(run, 2)
+	}
+	a.Equal(90-1, counts[nodes[0]])
+	a.Equal(50-1, counts[nodes[1]])
+	a.Equal(80-1, counts[nodes[2]])
+}
+
+func Test_weightedRoundRobin_Select_invalidWeight(t *testing.T) {
+	a := assert.New(t)
+	nodes := []*discovery.ServiceNode{
+		{
+			ServiceName: "test",
+			IP:          net.IPv4(127, 0, 0, 1),
+			Port:        8484,
+			Tags:        map[string]string{},
+		},
+		{
+			ServiceName: "test",
+			IP:          net.IPv4(127, 0, 0, 2),
+			Port:        8484,
+			Tags: map[string]string{
+				"weight": "0",
+			},
+		},
+		{
+			ServiceName: "test",
+			IP:          net.IPv4(127, 0, 0, 3),
+			Port:        8484,
+			Tags: map[string]string{
+				"weight": "abc",
+			},
+		},
+	}
+
+	// 缺失或不合法的权重按 1 处理
+	lb := NewWeightedRoundRobin()
+	for i := 0; i < 2; i++ {
+		for _, expected := range nodes {
+			node, _ := lb.Select(context.Background(), "test", nodes)
+			a.Equal(expected, node)
+		}
+	}
+}
+
+func Test_weightedRoundRobin_Select_weightChanged(t *testing.T) {
+	a := assert.New(t)
+	nodes := []*discovery.ServiceNode{
+		{
+			ServiceName: "test",
+			IP:          net.IPv4(127, 0, 0, 1),
+			Port:        8484,
+			Tags: map[string]string{
+				"weight": "1",
+			},
+		},
+		{
+			ServiceName: "test",
+			IP:          net.IPv4(127, 0, 0, 2),
+			Port:        8484,
+			Tags: map[string]string{
+				"weight": "1",
+			},
+		},
+	}
+
+	lb := &weightedRoundRobin{current: make(map[string]int)}
+	node, _ := lb.Select(context.Background(), nodes)
 	a.Equal(nodes[0], node)
 
-	node = lb.Select(nodes)
-	a.Equal(nodes[2], node)
+	// 节点权重变化后保留原有的当前权重
+	changed := []*discovery.ServiceNode{
+		nodes[0],
+		{
+			ServiceName: "test",
+			IP:          net.IPv4(127, 0, 0, 2),
+			Port:        8484,
+			Tags: map[string]string{
+				"weight": "2",
+			},
+		},
+	}
+	a.Equal(map[string]int{"127.0.0.1:8484": -1, "127.0.0.2:8484": 1}, lb.current)
+	node, _ = lb.Select(context.Background(), changed)
+	a.Equal(changed[1], node)
+	a.Equal(map[string]int{"127.0.0.1:8484": 0, "127.0.0.2:8484": 0}, lb.current)
+
+	// 节点下线后清理其当前权重
+	node, _ = lb.Select(context.Background(), changed[1:])
+	a.Equal(changed[1], node)
+	a.Equal(map[string]int{"127.0.0.2:8484": 0}, lb.current)
 }
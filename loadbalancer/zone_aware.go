@@ -0,0 +1,74 @@
+package loadbalancer
+
+import (
+	"context"
+	"github.com/xialeistudio/go-service-discovery/discovery"
+	"math/rand"
+	"sync"
+	"time"
+)
+
+// ZoneAwareConfig 区域感知负载均衡配置
+type ZoneAwareConfig struct {
+	// LocalZone 调用方所在的区域
+	LocalZone string
+	// ZoneTag 节点区域的标签名，默认为 zone
+	ZoneTag string
+	// MinLocalNodes 本区域节点数不少于该值时流量全部留在本区域，默认为 1
+	// 不足时按 本区域节点数/MinLocalNodes 的比例留在本区域，其余流量溢出到其他区域
+	MinLocalNodes int
+}
+
+type zoneAware struct {
+	inner  LoadBalancer
+	config ZoneAwareConfig
+	mu     sync.Mutex
+	r      *rand.Rand
+}
+
+func (z *zoneAware) Select(ctx context.Context, serviceName string, nodes []*discovery.ServiceNode) (*discovery.ServiceNode, DoneFunc) {
+	var local, remote []*discovery.ServiceNode
+	for _, node := range nodes {
+		if node.Tags[z.config.ZoneTag] == z.config.LocalZone {
+			local = append(local, node)
+		} else {
+			remote = append(remote, node)
+		}
+	}
+
+	if len(remote) > 0 && !z.preferLocal(len(local)) {
+		// 溢出到其他区域，由内部策略在所有其他区域的节点中选择，各区域分到的流量与节点数成正比
+		// 本区域与其他区域使用不同的 key，互不影响内部策略的状态
+		return z.inner.Select(ctx, serviceName+"#remote", remote)
+	}
+	return z.inner.Select(ctx, serviceName, local)
+}
+
+// preferLocal 本区域容量不足时按比例决定是否留在本区域
+func (z *zoneAware) preferLocal(localCount int) bool {
+	if localCount >= z.config.MinLocalNodes {
+		return true
+	}
+	if localCount == 0 {
+		return false
+	}
+	z.mu.Lock()
+	defer z.mu.Unlock()
+	return z.r.Intn(z.config.MinLocalNodes) < localCount
+}
+
+// NewZoneAware 区域感知负载均衡，优先选择与调用方同区域的节点，本区域容量不足时按比例溢出到其他区域
+// 节点的选择委托给 inner
+func NewZoneAware(inner LoadBalancer, config ZoneAwareConfig) LoadBalancer {
+	if config.ZoneTag == "" {
+		config.ZoneTag = "zone"
+	}
+	if config.MinLocalNodes <= 0 {
+		config.MinLocalNodes = 1
+	}
+	return &zoneAware{
+		inner:  inner,
+		config: config,
+		r:      rand.New(rand.NewSource(time.Now().UnixNano())),
+	}
+}
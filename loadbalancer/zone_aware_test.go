@@ -0,0 +1,76 @@
+package loadbalancer
+
+import (
+	"context"
+	"github.com/stretchr/testify/assert"
+	"github.com/xialeistudio/go-service-discovery/discovery"
+	"math/rand"
+	"net"
+	"testing"
+)
+
+func newTagTestNodes(tag string, values ...string) []*discovery.ServiceNode {
+	nodes := make([]*discovery.ServiceNode, len(values))
+	for i, value := range values {
+		nodes[i] = &discovery.ServiceNode{
+			ServiceName: "test",
+			IP:          net.IPv4(127, 0, 0, byte(i+1)),
+			Port:        8484,
+			Tags: map[string]string{
+				tag: value,
+			},
+		}
+	}
+	return nodes
+}
+
+func countTags(lb LoadBalancer, nodes []*discovery.ServiceNode, tag string, times int) map[string]int {
+	counts := make(map[string]int)
+	for i := 0; i < times; i++ {
+		node, done := lb.Select(context.Background(), "test", nodes)
+		done(DoneInfo{})
+		counts[node.Tags[tag]]++
+	}
+	return counts
+}
+
+func Test_zoneAware_Select(t *testing.T) {
+	a := assert.New(t)
+	lb := &zoneAware{
+		inner: NewRoundRobin(),
+		config: ZoneAwareConfig{
+			LocalZone:     "a",
+			ZoneTag:       "zone",
+			MinLocalNodes: 2,
+		},
+		r: rand.New(rand.NewSource(1)),
+	}
+
+	// 本区域容量充足时流量全部留在本区域
+	nodes := newTagTestNodes("zone", "a", "a", "b", "c")
+	a.Equal(map[string]int{"a": 100}, countTags(lb, nodes, "zone", 100))
+	// 本区域的节点轮流被选中
+	first, _ := lb.Select(context.Background(), "test", nodes)
+	second, _ := lb.Select(context.Background(), "test", nodes)
+	a.NotEqual(first, second)
+
+	// 本区域容量不足时按比例溢出，其他区域按节点数分配
+	nodes = newTagTestNodes("zone", "a", "b", "b", "c", "c")
+	counts := countTags(lb, nodes, "zone", 10000)
+	a.InDelta(5000, counts["a"], 300)
+	a.InDelta(2500, counts["b"], 300)
+	a.InDelta(2500, counts["c"], 300)
+
+	// 本区域没有节点时全部溢出
+	nodes = newTagTestNodes("zone", "b", "c")
+	a.Equal(map[string]int{"b": 50, "c": 50}, countTags(lb, nodes, "zone", 100))
+}
+
+func Test_NewZoneAware(t *testing.T) {
+	a := assert.New(t)
+	lb := NewZoneAware(NewRoundRobin(), ZoneAwareConfig{LocalZone: "a"})
+
+	// 默认只要本区域有节点就不溢出
+	nodes := newTagTestNodes("zone", "b", "a", "c")
+	a.Equal(map[string]int{"a": 10}, countTags(lb, nodes, "zone", 10))
+}